@@ -17,47 +17,70 @@
 package analytics
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
 	"runtime/debug"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/imports"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
 )
 
-func New(config Config, libConfig configuration.Config, auth *auth.Auth, smartServiceRepo SmartServiceRepo, imports Imports, devices Devices) *Analytics {
-	return &Analytics{config: config, libConfig: libConfig, auth: auth, smartServiceRepo: smartServiceRepo, imports: imports, devices: devices}
+// New creates the task handler
+// ctx is the base of all task contexts; cancelling it (e.g. on shutdown) aborts in-flight upstream requests
+func New(ctx context.Context, config Config, libConfig configuration.Config, auth Auth, smartServiceRepo SmartServiceRepo, imports Imports, devices Devices, flowEngine *httpclient.Client, flowParser *httpclient.Client) *Analytics {
+	return &Analytics{ctx: ctx, config: config, libConfig: libConfig, auth: auth, smartServiceRepo: smartServiceRepo, imports: imports, devices: devices, flowEngine: flowEngine, flowParser: flowParser, reconcileInstances: map[string]bool{}}
 }
 
 type Analytics struct {
-	config           Config
-	libConfig        configuration.Config
-	auth             *auth.Auth
-	smartServiceRepo SmartServiceRepo
-	imports          Imports
-	devices          Devices
+	ctx                context.Context
+	config             Config
+	libConfig          configuration.Config
+	auth               Auth
+	smartServiceRepo   SmartServiceRepo
+	imports            Imports
+	devices            Devices
+	flowEngine         *httpclient.Client
+	flowParser         *httpclient.Client
+	reconcileInstances map[string]bool
+	reconcileMux       sync.Mutex
 }
 
 type Imports interface {
-	GetTopic(token auth.Token, importId string) (topic string, err error)
+	GetImport(ctx context.Context, token auth.Token, importId string) (result imports.Import, err error)
+	GetImports(ctx context.Context, token auth.Token, importIds []string) (result map[string]imports.Import, err error)
+	GetImportType(ctx context.Context, token auth.Token, importTypeId string) (result imports.ImportType, err error)
+}
+
+type Auth interface {
+	ExchangeUserToken(userid string) (token auth.Token, err error)
 }
 
 type SmartServiceRepo interface {
 	GetInstanceUser(instanceId string) (userId string, err error)
 	ListExistingModules(processInstanceId string, query model.ModulQuery) (result []model.SmartServiceModule, err error)
+	SendWorkerModules(modules []model.Module) (result []model.SmartServiceModule, err error)
 }
 
 type Devices interface {
-	GetDeviceInfosOfGroup(token auth.Token, groupId string) (devices []devices.Device, deviceTypeIds []string, err error)
-	GetDeviceInfosOfDevices(token auth.Token, deviceIds []string) (devices []devices.Device, deviceTypeIds []string, err error)
-	GetDeviceTypeSelectables(token auth.Token, criteria []devices.FilterCriteria, includeModified bool, servicesMustMatchAllCriteria bool) (result []devices.DeviceTypeSelectable, err error)
+	GetDeviceGroup(ctx context.Context, token auth.Token, groupId string) (result devices.DeviceGroup, err error)
+	GetDeviceInfosOfDevices(ctx context.Context, token auth.Token, deviceIds []string) (devices []devices.Device, deviceTypeIds []string, unreadableDeviceIds []string, err error)
+	GetDevicesOfDeviceTypes(ctx context.Context, token auth.Token, deviceTypeIds []string) (devices []devices.Device, err error)
+	GetDeviceTypeSelectables(ctx context.Context, token auth.Token, criteria []devices.FilterCriteria, includeModified bool, servicesMustMatchAllCriteria bool) (result []devices.DeviceTypeSelectable, err error)
 }
 
 func (this *Analytics) Do(task model.CamundaExternalTask) (modules []model.Module, outputs map[string]interface{}, err error) {
@@ -72,19 +95,89 @@ func (this *Analytics) Do(task model.CamundaExternalTask) (modules []model.Modul
 		return modules, outputs, err
 	}
 
+	ctx, cancel := this.newTaskContext()
+	defer cancel()
+
+	err = this.retryTransient(ctx, task.ProcessInstanceId, func() (err error) {
+		modules, outputs, err = this.doTask(ctx, token, task)
+		return err
+	})
+	return modules, outputs, err
+}
+
+// retryTransient calls attempt until it succeeds or returns a non-transient error (see IsTransientError)
+// transient errors are retried with taskRetryBackoff, as long as the backoff ends before the deadline of ctx
+func (this *Analytics) retryTransient(ctx context.Context, processInstanceId string, attempt func() error) (err error) {
+	for i := 0; ; i++ {
+		err = attempt()
+		if err == nil {
+			return nil
+		}
+		if !IsTransientError(err) {
+			this.libConfig.GetLogger().Warn("unable to handle analytics task", "processInstanceId", processInstanceId, "error", err)
+			return err
+		}
+		backoff := this.taskRetryBackoff(i)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(backoff).After(deadline) {
+			this.libConfig.GetLogger().Error("unable to handle analytics task, retries exhausted before task deadline", "processInstanceId", processInstanceId, "attempts", i+1, "error", err)
+			return err
+		}
+		this.libConfig.GetLogger().Warn("transient error while handling analytics task --> retry", "processInstanceId", processInstanceId, "attempt", i+1, "backoff", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// taskRetryBackoff returns a random duration between 0 and the configured backoff * 2^attempt (at most the configured max backoff)
+func (this *Analytics) taskRetryBackoff(attempt int) time.Duration {
+	initial, max, err := this.config.GetTaskRetryBackoff()
+	if err != nil {
+		initial, max = DefaultTaskRetryBackoff, DefaultTaskRetryMaxBackoff
+	}
+	limit := initial
+	for i := 0; i < attempt && limit < max; i++ {
+		limit = limit * 2
+	}
+	return rand.N(min(limit, max))
+}
+
+// doTask handles a single attempt of Do
+func (this *Analytics) doTask(ctx context.Context, token auth.Token, task model.CamundaExternalTask) (modules []model.Module, outputs map[string]interface{}, err error) {
 	outputs = map[string]interface{}{}
+	state := newTaskState(this.devices)
+
+	//a malformed dry_run fails in validateParameters; it is handled as dry run, so that it never deploys
+	if dryRun, err := this.getDryRun(task); dryRun || err != nil {
+		modules, returnData, err := this.handleAnalyticsDryRun(ctx, token, task, state)
+		if err != nil {
+			return modules, returnData, err
+		}
+		return modules, returnData, state.addOutputs(returnData)
+	}
 
 	key := this.getModuleKey(task)
 
-	module, returnData, err := this.handleAnalyticsCommand(token, task, key)
+	module, returnData, err := this.handleAnalyticsCommand(ctx, token, task, key, state)
+	if err != nil {
+		return modules, returnData, err
+	}
+	err = state.addOutputs(returnData)
 	if err != nil {
 		return modules, returnData, err
 	}
 
+	if key != nil && this.getReconcile(task) {
+		this.AddReconcileInstance(task.ProcessInstanceId)
+	}
+
 	moduleData := this.getModuleData(task)
 	for key, value := range module.ModuleData {
 		moduleData[key] = value
 	}
+	state.addModuleData(moduleData)
 	module.ModuleData = moduleData
 
 	modules = append(modules, module)
@@ -95,11 +188,23 @@ func (this *Analytics) Do(task model.CamundaExternalTask) (modules []model.Modul
 	return modules, outputs, err
 }
 
+// newTaskContext returns a context derived from the handler context
+// the deadline leaves 10% of the camunda lock duration to report the task result before the lock expires
+func (this *Analytics) newTaskContext() (context.Context, context.CancelFunc) {
+	lockDuration := time.Duration(this.libConfig.CamundaLockDurationInMs) * time.Millisecond
+	if lockDuration <= 0 {
+		return context.WithCancel(this.ctx)
+	}
+	return context.WithTimeout(this.ctx, lockDuration*9/10)
+}
+
 func (this *Analytics) Undo(modules []model.Module, reason error) {
 	this.libConfig.GetLogger().Debug("undo", "reason", reason)
+	ctx, cancel := this.newTaskContext()
+	defer cancel()
 	for _, module := range modules {
 		if module.DeleteInfo != nil {
-			err := this.useModuleDeleteInfo(*module.DeleteInfo)
+			err := this.useModuleDeleteInfo(ctx, *module.DeleteInfo)
 			if err != nil {
 				this.libConfig.GetLogger().Error("error in useModuleDeleteInfo", "error", err, "stack", string(debug.Stack()))
 			}
@@ -107,8 +212,8 @@ func (this *Analytics) Undo(modules []model.Module, reason error) {
 	}
 }
 
-func (this *Analytics) useModuleDeleteInfo(info model.ModuleDeleteInfo) error {
-	req, err := http.NewRequest("DELETE", info.Url, nil)
+func (this *Analytics) useModuleDeleteInfo(ctx context.Context, info model.ModuleDeleteInfo) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", info.Url, nil)
 	if err != nil {
 		return err
 	}
@@ -119,7 +224,7 @@ func (this *Analytics) useModuleDeleteInfo(info model.ModuleDeleteInfo) error {
 		}
 		req.Header.Set("Authorization", token.Jwt())
 	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := this.flowEngine.Do(req) //delete infos reference flow engine pipelines
 	if err != nil {
 		return err
 	}
@@ -138,25 +243,25 @@ func (this *Analytics) getModuleId(task model.CamundaExternalTask) string {
 	return task.ProcessInstanceId + "." + task.Id
 }
 
-func (this *Analytics) handleAnalyticsCommand(token auth.Token, task model.CamundaExternalTask, key *string) (module model.Module, outputs map[string]interface{}, err error) {
+func (this *Analytics) handleAnalyticsCommand(ctx context.Context, token auth.Token, task model.CamundaExternalTask, key *string, state *taskState) (module model.Module, outputs map[string]interface{}, err error) {
 	if key != nil {
-		return this.handleAnalyticsCommandWithKey(token, task, *key)
+		return this.handleAnalyticsCommandWithKey(ctx, token, task, *key, state)
 	} else {
-		return this.handleAnalyticsCreate(token, task, []string{})
+		return this.handleAnalyticsCreate(ctx, token, task, []string{}, state)
 	}
 }
 
-func (this *Analytics) handleAnalyticsCommandWithKey(token auth.Token, task model.CamundaExternalTask, key string) (module model.Module, outputs map[string]interface{}, err error) {
+func (this *Analytics) handleAnalyticsCommandWithKey(ctx context.Context, token auth.Token, task model.CamundaExternalTask, key string, state *taskState) (module model.Module, outputs map[string]interface{}, err error) {
 	module, exists, err := this.getExistingModule(task.ProcessInstanceId, key, this.libConfig.CamundaWorkerTopic)
 	if !exists {
-		return this.handleAnalyticsCreate(token, task, []string{key})
+		return this.handleAnalyticsCreate(ctx, token, task, []string{key}, state)
 	}
 	setModuleUpdateVersion(&module)
 
 	pipelineIdInterface, ok := module.ModuleData["pipeline_id"]
 	if !ok {
 		this.libConfig.GetLogger().Warn("pipeline-id output not found in module", "module", module)
-		return this.handleAnalyticsCreate(token, task, []string{key})
+		return this.handleAnalyticsCreate(ctx, token, task, []string{key}, state)
 	}
 	pipelineId, ok := pipelineIdInterface.(string)
 	if !ok {
@@ -167,60 +272,104 @@ func (this *Analytics) handleAnalyticsCommandWithKey(token auth.Token, task mode
 	outputs = map[string]interface{}{
 		"pipeline_id": pipelineId,
 	}
+	module.ModuleData[ReconcileVariablesField] = this.getReconcileVariables(task)
 
-	pipelineRequest, err := this.getPipelineRequest(token, task)
+	pipelineRequest, err := this.getPipelineRequest(ctx, token, task, state)
 	if err != nil {
 		return module, outputs, err
 	}
 	pipelineRequest.Id = pipelineId
 
-	_, err, _ = this.SendUpdateRequest(token, pipelineRequest)
+	hash, err := HashPipelineRequest(pipelineRequest)
 	if err != nil {
 		return module, outputs, err
 	}
+	if previousHash, ok := module.ModuleData[PipelineRequestHashField].(string); ok && previousHash == hash {
+		this.libConfig.GetLogger().Info("pipeline request unchanged --> skip update", "pipelineId", pipelineId, "hash", hash)
+		return module, outputs, nil
+	}
+
+	_, err, _ = this.SendUpdateRequest(ctx, token, pipelineRequest)
+	if err != nil {
+		return module, outputs, err
+	}
+	module.ModuleData[PipelineRequestHashField] = hash
 	return module, outputs, nil
 }
 
-func (this *Analytics) handleAnalyticsCreate(token auth.Token, task model.CamundaExternalTask, keys []string) (module model.Module, outputs map[string]interface{}, err error) {
-	pipelineRequest, err := this.getPipelineRequest(token, task)
+// handleAnalyticsDryRun resolves the pipeline request without deploying it and returns it as output
+func (this *Analytics) handleAnalyticsDryRun(ctx context.Context, token auth.Token, task model.CamundaExternalTask, state *taskState) (modules []model.Module, outputs map[string]interface{}, err error) {
+	pipelineRequest, err := this.getPipelineRequest(ctx, token, task, state)
+	if err != nil {
+		return modules, outputs, err
+	}
+	temp, err := json.Marshal(pipelineRequest)
+	if err != nil {
+		return modules, outputs, err
+	}
+	return modules, map[string]interface{}{
+		"pipeline_request": string(temp),
+	}, nil
+}
+
+func (this *Analytics) handleAnalyticsCreate(ctx context.Context, token auth.Token, task model.CamundaExternalTask, keys []string, state *taskState) (module model.Module, outputs map[string]interface{}, err error) {
+	pipelineRequest, err := this.getPipelineRequest(ctx, token, task, state)
 	if err != nil {
 		return module, outputs, err
 	}
 
-	pipeline, err, _ := this.SendDeployRequest(token, pipelineRequest)
+	hash, err := HashPipelineRequest(pipelineRequest)
 	if err != nil {
 		return module, outputs, err
 	}
 
+	pipeline, err, _ := this.SendDeployRequest(ctx, token, pipelineRequest)
+	if err != nil {
+		return module, outputs, err
+	}
+
+	moduleData := map[string]interface{}{
+		"pipeline_id":            pipeline.Id.String(),
+		"pipeline":               pipeline,
+		PipelineRequestHashField: hash,
+	}
+	if len(keys) > 0 {
+		//only keyed modules can be reconciled
+		moduleData[ReconcileVariablesField] = this.getReconcileVariables(task)
+	}
+
 	return model.Module{
-			Id:               this.getModuleId(task),
-			ProcesInstanceId: task.ProcessInstanceId,
-			SmartServiceModuleInit: model.SmartServiceModuleInit{
-				DeleteInfo: &model.ModuleDeleteInfo{
-					Url:    this.config.FlowEngineUrl + "/pipeline/" + url.PathEscape(pipeline.Id.String()),
-					UserId: token.GetUserId(),
-				},
-				ModuleType: this.libConfig.CamundaWorkerTopic,
-				ModuleData: map[string]interface{}{
-					"pipeline_id": pipeline.Id.String(),
-					"pipeline":    pipeline,
-				},
-				Keys: keys,
+		Id:               this.getModuleId(task),
+		ProcesInstanceId: task.ProcessInstanceId,
+		SmartServiceModuleInit: model.SmartServiceModuleInit{
+			DeleteInfo: &model.ModuleDeleteInfo{
+				Url:    this.config.FlowEngineUrl + "/pipeline/" + url.PathEscape(pipeline.Id.String()),
+				UserId: token.GetUserId(),
 			},
-		}, map[string]interface{}{
-			"pipeline_id": pipeline.Id.String(),
-		}, nil
+			ModuleType: this.libConfig.CamundaWorkerTopic,
+			ModuleData: moduleData,
+			Keys:       keys,
+		},
+	}, map[string]interface{}{
+		"pipeline_id": pipeline.Id.String(),
+	}, nil
 
 }
 
-func (this *Analytics) getPipelineRequest(token auth.Token, task model.CamundaExternalTask) (pipelineRequest PipelineRequest, err error) {
+func (this *Analytics) getPipelineRequest(ctx context.Context, token auth.Token, task model.CamundaExternalTask, state *taskState) (pipelineRequest PipelineRequest, err error) {
 	flowId := this.getFlowId(task)
 	if flowId == "" {
 		err = errors.New("missing flow id")
 		return pipelineRequest, err
 	}
-	inputs, err, _ := this.GetFlowInputs(token, flowId)
+	inputs, err, _ := this.GetFlowInputs(ctx, token, flowId)
+	if err != nil {
+		return pipelineRequest, err
+	}
+
+	err = this.validateParameters(task, inputs)
 	if err != nil {
+		this.libConfig.GetLogger().Warn("invalid analytics parameters", "error", err)
 		return pipelineRequest, err
 	}
 
@@ -248,15 +397,31 @@ func (this *Analytics) getPipelineRequest(token auth.Token, task model.CamundaEx
 
 	pipelineRequest.Description = this.getPipelineDescription(task)
 
-	pipelineRequest.Nodes, err = this.inputsToNodes(token, task, inputs)
+	pipelineRequest.Nodes, err = this.inputsToNodes(ctx, token, task, inputs, state)
 	if err != nil {
 		return pipelineRequest, err
 	}
 
+	//name and description may reference entities resolved in inputsToNodes
+	pipelineRequest.Name = this.renderTemplate(task, state, pipelineRequest.Name)
+	pipelineRequest.Description = this.renderTemplate(task, state, pipelineRequest.Description)
+
 	return pipelineRequest, nil
 }
 
-func (this *Analytics) inputsToNodes(token auth.Token, task model.CamundaExternalTask, inputs []FlowModelCell) (result []PipelineNode, err error) {
+func (this *Analytics) inputsToNodes(ctx context.Context, token auth.Token, task model.CamundaExternalTask, inputs []FlowModelCell, state *taskState) (result []PipelineNode, err error) {
+	strictNodeConfig := this.getStrictNodeConfig(task)
+	emptySelectionPolicy, err := this.getEmptySelectionPolicy(task)
+	if err != nil {
+		return result, err
+	}
+	requestOnlyPolicy, err := this.getRequestOnlyPolicy(task)
+	if err != nil {
+		return result, err
+	}
+	this.prefetchImports(ctx, token, task, inputs, state)
+	configWarnings := []NodeConfigWarning{}
+	nodesWithEmptyPorts := map[string]bool{}
 	for _, input := range inputs {
 		node := PipelineNode{
 			NodeId:      input.Id,
@@ -264,50 +429,123 @@ func (this *Analytics) inputsToNodes(token auth.Token, task model.CamundaExterna
 			Config:      nil,
 			PersistData: this.getPersistData(task, input.Id),
 		}
+		node.WindowTime, err = this.getNodeWindowTime(task, input.Id)
+		if err != nil {
+			return result, err
+		}
+		node.MergeStrategy, err = this.getNodeMergeStrategy(task, input.Id)
+		if err != nil {
+			return result, err
+		}
 		for _, conf := range input.Config {
 			nodeConf := NodeConfig{
 				Name: conf.Name,
 			}
-			nodeConf.Value, err = this.getPipelineNodeConfig(task, input.Id, conf.Name)
+			nodeConf.Value, err = this.getPipelineNodeConfig(task, input.Id, conf)
 			if err != nil {
-				return result, err
+				if strictNodeConfig {
+					return result, err
+				}
+				configWarnings = append(configWarnings, NodeConfigWarning{
+					NodeId: input.Id,
+					Name:   conf.Name,
+					Type:   conf.Type,
+					Value:  nodeConf.Value,
+					Reason: err.Error(),
+				})
 			}
 			node.Config = append(node.Config, nodeConf)
 		}
 		for _, port := range input.InPorts {
-			selection, err := this.getSelection(task, input.Id, port)
+			targetCharacteristicId, err := this.getTargetCharacteristic(task, input.Id, port)
 			if err != nil {
 				return result, err
 			}
-			if selection.DeviceSelection == nil && selection.ImportSelection == nil && selection.DeviceGroupSelection == nil {
-				continue
+			portInputs := []NodeInput{}
+			//unselected ports (e.g. unconnected optional ports) are not empty
+			selected := false
+			if this.isCriteriaOnlySelection(task, input.Id, port) {
+				selected = true
+				portInputs, err = this.criteriaSelectionToNodeInputs(ctx, token, task, input.Id, port, state)
+				if err != nil {
+					return result, err
+				}
+			} else {
+				selections, err := this.getSelections(task, input.Id, port)
+				if err != nil {
+					return result, err
+				}
+				for _, selection := range selections {
+					if selection.DeviceSelection == nil && selection.ImportSelection == nil && selection.DeviceGroupSelection == nil {
+						continue
+					}
+					selected = true
+					nodeInput, err := this.selectionToNodeInputs(ctx, token, selection, task, input.Id, port, state)
+					if err != nil {
+						return result, err
+					}
+					portInputs = append(portInputs, nodeInput...)
+				}
 			}
-			nodeInput, err := this.selectionToNodeInputs(token, selection, task, input.Id, port)
-			if err != nil {
-				return result, err
+			if selected && len(portInputs) == 0 {
+				state.addEmptyPort(input.Id, port)
+				nodesWithEmptyPorts[input.Id] = true
 			}
-			node.Inputs = append(node.Inputs, nodeInput...)
+			setTargetCharacteristic(portInputs, targetCharacteristicId)
+			node.Inputs = append(node.Inputs, portInputs...)
 		}
 
 		//group inputs by topic, and filter
 		node.Inputs = groupInputs(node.Inputs)
 
-		sort.Slice(node.Inputs, func(i, j int) bool {
+		sort.SliceStable(node.Inputs, func(i, j int) bool {
 			return node.Inputs[i].TopicName < node.Inputs[j].TopicName
 		})
 		result = append(result, node)
 	}
+	if len(configWarnings) > 0 {
+		this.libConfig.GetLogger().Warn("pipeline node configs defaulted or passed through uncoerced", "processInstanceId", task.ProcessInstanceId, "configs", configWarnings)
+	}
+	if requestOnly := state.getRequestOnlyDevices(); len(requestOnly) > 0 {
+		if requestOnlyPolicy == RequestOnlyPolicyFail {
+			return result, fmt.Errorf("selected devices only offer request services matching the criteria: %v", describeRequestOnlyDevices(requestOnly))
+		}
+		this.libConfig.GetLogger().Warn("selected devices only offer request services matching the criteria --> excluded", "processInstanceId", task.ProcessInstanceId, "devices", describeRequestOnlyDevices(requestOnly))
+	}
+	if len(state.emptyPorts) > 0 {
+		switch emptySelectionPolicy {
+		case EmptySelectionPolicyFail:
+			return result, fmt.Errorf("selections of pipeline input ports resolved to nothing: %v", strings.Join(state.emptyPorts, ", "))
+		case EmptySelectionPolicySkipNode:
+			this.libConfig.GetLogger().Warn("selections of pipeline input ports resolved to nothing --> skip nodes", "processInstanceId", task.ProcessInstanceId, "ports", state.emptyPorts)
+			result = slices.DeleteFunc(result, func(node PipelineNode) bool {
+				return nodesWithEmptyPorts[node.NodeId]
+			})
+			if len(result) == 0 {
+				return result, fmt.Errorf("all pipeline nodes skipped, selections of pipeline input ports resolved to nothing: %v", strings.Join(state.emptyPorts, ", "))
+			}
+		default:
+			this.libConfig.GetLogger().Warn("selections of pipeline input ports resolved to nothing", "processInstanceId", task.ProcessInstanceId, "ports", state.emptyPorts)
+		}
+	}
 	return result, nil
 }
 
+// groupInputs merges inputs with the same topic and filter
+// the result is ordered by the first occurrence of each topic/filter combination
 func groupInputs(in []NodeInput) (out []NodeInput) {
 	group := map[string][]NodeInput{}
+	keys := []string{}
 	for _, element := range in {
 		key := element.TopicName + "_" + element.FilterType + "_" + element.FilterIds
+		if _, ok := group[key]; !ok {
+			keys = append(keys, key)
+		}
 		group[key] = append(group[key], element)
 	}
 	out = []NodeInput{}
-	for _, element := range group {
+	for _, key := range keys {
+		element := group[key]
 		elementInput := NodeInput{
 			FilterIds:  "",
 			FilterType: "",
@@ -324,18 +562,31 @@ func groupInputs(in []NodeInput) (out []NodeInput) {
 	return out
 }
 
-func (this *Analytics) selectionToNodeInputs(token auth.Token, selection model.IotOption, task model.CamundaExternalTask, inputId string, portName string) (result []NodeInput, err error) {
+// setTargetCharacteristic marks all values of the inputs to be converted to the given characteristic
+// nothing is changed if targetCharacteristicId is empty
+func setTargetCharacteristic(inputs []NodeInput, targetCharacteristicId string) {
+	if targetCharacteristicId == "" {
+		return
+	}
+	for i := range inputs {
+		for j := range inputs[i].Values {
+			inputs[i].Values[j].TargetCharacteristicId = targetCharacteristicId
+		}
+	}
+}
+
+func (this *Analytics) selectionToNodeInputs(ctx context.Context, token auth.Token, selection model.IotOption, task model.CamundaExternalTask, inputId string, portName string, state *taskState) (result []NodeInput, err error) {
 	if selection.DeviceSelection != nil {
 		if selection.DeviceSelection.ServiceId == nil {
-			return this.deviceWithoutServiceSelectionToNodeInputs(token, *selection.DeviceSelection, task, inputId, portName)
+			return this.deviceWithoutServiceSelectionToNodeInputs(ctx, token, *selection.DeviceSelection, task, inputId, portName, state)
 		}
 		return this.deviceSelectionToNodeInputs(*selection.DeviceSelection, portName)
 	}
 	if selection.ImportSelection != nil {
-		return this.importSelectionToNodeInputs(token, *selection.ImportSelection, portName)
+		return this.importSelectionToNodeInputs(ctx, token, *selection.ImportSelection, task, inputId, portName, state)
 	}
 	if selection.DeviceGroupSelection != nil {
-		return this.groupSelectionToNodeInputs(token, *selection.DeviceGroupSelection, task, inputId, portName)
+		return this.groupSelectionToNodeInputs(ctx, token, *selection.DeviceGroupSelection, task, inputId, portName, state)
 	}
 	return result, errors.New("expect selection to contain none nil value")
 }
@@ -353,68 +604,119 @@ func (this *Analytics) deviceSelectionToNodeInputs(selection model.DeviceSelecti
 		FilterType: DeviceFilterType,
 		TopicName:  ServiceIdToTopic(*selection.ServiceId),
 		Values: []NodeValue{{
-			Name: inputPort,
-			Path: path,
+			Name:             inputPort,
+			Path:             path,
+			CharacteristicId: derefString(selection.CharacteristicId),
 		}},
 	}}, nil
 }
 
-func (this *Analytics) deviceWithoutServiceSelectionToNodeInputs(token auth.Token, selection model.DeviceSelection, task model.CamundaExternalTask, inputId string, portName string) (result []NodeInput, err error) {
+func (this *Analytics) deviceWithoutServiceSelectionToNodeInputs(ctx context.Context, token auth.Token, selection model.DeviceSelection, task model.CamundaExternalTask, inputId string, portName string, state *taskState) (result []NodeInput, err error) {
 	criteria, err := this.getNodePathCriteria(task, inputId, portName)
 	if err != nil {
 		return result, err
 	}
-	serviceIds, serviceToDevices, serviceToPaths, err := this.getServicesAndPathsForDeviceIdList(token, []string{selection.DeviceId}, criteria)
+	strategy, err := this.getPathStrategy(task, inputId, portName, criteria)
 	if err != nil {
 		return result, err
 	}
+	serviceIds, serviceToDevices, serviceToPaths, excluded, err := this.getServicesAndPathsForDeviceIdList(ctx, token, []string{selection.DeviceId}, criteria, state)
+	if err != nil {
+		return result, err
+	}
+	excluded, err = this.completeDeviceExclusions(ctx, token, criteria, excluded, inputId+"."+portName, state)
+	if err != nil {
+		return result, err
+	}
+	state.addExcludedDevices(excluded)
 
 	serviceCriteria, err := this.getNodeServiceCriteria(task, inputId, portName)
 	if err != nil {
 		return result, err
 	}
 	if len(serviceCriteria) > 0 {
-		filterServiceIds, _, _, err := this.getServicesAndPathsForDeviceIdList(token, []string{selection.DeviceId}, serviceCriteria)
+		filterServiceIds, _, _, _, err := this.getServicesAndPathsForDeviceIdList(ctx, token, []string{selection.DeviceId}, serviceCriteria, state)
 		if err != nil {
 			return result, err
 		}
+		unfilteredServiceToDevices := serviceToDevices
 		serviceIds, serviceToDevices, serviceToPaths = filterServices(serviceIds, serviceToDevices, serviceToPaths, filterServiceIds)
+		state.addExcludedDevices(getFilteredDeviceExclusions(unfilteredServiceToDevices, serviceToDevices, inputId+"."+portName))
 	}
 
-	result = this.serviceInfosToNodeInputs(serviceIds, serviceToDevices, serviceToPaths, portName)
-	return result, nil
+	return this.serviceInfosToNodeInputs(serviceIds, serviceToDevices, serviceToPaths, portName, strategy)
 }
 
-func (this *Analytics) groupSelectionToNodeInputs(token auth.Token, selection model.DeviceGroupSelection, task model.CamundaExternalTask, inputId string, portName string) (result []NodeInput, err error) {
+func (this *Analytics) groupSelectionToNodeInputs(ctx context.Context, token auth.Token, selection model.DeviceGroupSelection, task model.CamundaExternalTask, inputId string, portName string, state *taskState) (result []NodeInput, err error) {
 	criteria, err := this.getNodePathCriteria(task, inputId, portName)
 	if err != nil {
 		return result, err
 	}
-	serviceIds, serviceToDevices, serviceToPaths, err := this.getServicesAndPathsForGroupSelection(token, selection, criteria)
+	strategy, err := this.getPathStrategy(task, inputId, portName, criteria)
+	if err != nil {
+		return result, err
+	}
+	serviceIds, serviceToDevices, serviceToPaths, excluded, err := this.getServicesAndPathsForGroupSelection(ctx, token, selection, criteria, state)
 	if err != nil {
 		return result, err
 	}
+	excluded, err = this.completeDeviceExclusions(ctx, token, criteria, excluded, inputId+"."+portName, state)
+	if err != nil {
+		return result, err
+	}
+	state.addExcludedDevices(excluded)
 
 	serviceCriteria, err := this.getNodeServiceCriteria(task, inputId, portName)
 	if err != nil {
 		return result, err
 	}
 	if len(serviceCriteria) > 0 {
-		filterServiceIds, _, _, err := this.getServicesAndPathsForGroupSelection(token, selection, serviceCriteria)
+		filterServiceIds, _, _, _, err := this.getServicesAndPathsForGroupSelection(ctx, token, selection, serviceCriteria, state)
 		if err != nil {
 			return result, err
 		}
+		unfilteredServiceToDevices := serviceToDevices
 		serviceIds, serviceToDevices, serviceToPaths = filterServices(serviceIds, serviceToDevices, serviceToPaths, filterServiceIds)
+		state.addExcludedDevices(getFilteredDeviceExclusions(unfilteredServiceToDevices, serviceToDevices, inputId+"."+portName))
 	}
 
-	result = this.serviceInfosToNodeInputs(serviceIds, serviceToDevices, serviceToPaths, portName)
-	return result, nil
+	return this.serviceInfosToNodeInputs(serviceIds, serviceToDevices, serviceToPaths, portName, strategy)
 }
 
-func filterServices(ids []string, toDevices map[string][]string, paths map[string][]string, filter []string) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]string) {
+// criteriaSelectionToNodeInputs selects all devices of the user with a service matching the criteria
+func (this *Analytics) criteriaSelectionToNodeInputs(ctx context.Context, token auth.Token, task model.CamundaExternalTask, inputId string, portName string, state *taskState) (result []NodeInput, err error) {
+	criteria, err := this.getNodePathCriteria(task, inputId, portName)
+	if err != nil {
+		return result, err
+	}
+	strategy, err := this.getPathStrategy(task, inputId, portName, criteria)
+	if err != nil {
+		return result, err
+	}
+	serviceIds, serviceToDevices, serviceToPaths, err := this.getServicesAndPathsForCriteria(ctx, token, criteria, state)
+	if err != nil {
+		return result, err
+	}
+
+	serviceCriteria, err := this.getNodeServiceCriteria(task, inputId, portName)
+	if err != nil {
+		return result, err
+	}
+	if len(serviceCriteria) > 0 {
+		filterServiceIds, _, _, err := this.getServicesAndPathsForCriteria(ctx, token, serviceCriteria, state)
+		if err != nil {
+			return result, err
+		}
+		serviceIds, serviceToDevices, serviceToPaths = filterServices(serviceIds, serviceToDevices, serviceToPaths, filterServiceIds)
+	}
+
+	return this.serviceInfosToNodeInputs(serviceIds, serviceToDevices, serviceToPaths, portName, strategy)
+}
+
+func filterServices(ids []string, toDevices map[string][]string, paths map[string][]servicePath, filter []string) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]servicePath) {
 	serviceIds = []string{}
 	serviceToDevices = map[string][]string{}
-	serviceToPath = map[string][]string{}
+	serviceToPath = map[string][]servicePath{}
 	index := map[string]bool{}
 	for _, id := range filter {
 		index[id] = true
@@ -437,31 +739,32 @@ func filterServices(ids []string, toDevices map[string][]string, paths map[strin
 	return
 }
 
-func (this *Analytics) serviceInfosToNodeInputs(serviceIds []string, serviceToDevices map[string][]string, serviceToPaths map[string][]string, inputPort string) (result []NodeInput) {
+func (this *Analytics) serviceInfosToNodeInputs(serviceIds []string, serviceToDevices map[string][]string, serviceToPaths map[string][]servicePath, inputPort string, strategy pathStrategy) (result []NodeInput, err error) {
 	for _, serviceId := range serviceIds {
 		deviceIds := strings.Join(serviceToDevices[serviceId], ",")
 		if deviceIds == "" {
 			this.libConfig.GetLogger().Warn("missing deviceIds for service in serviceInfosToNodeInputs() --> skip service", "serviceId", serviceId)
 			continue
 		}
-		paths := serviceToPaths[serviceId]
-		if len(paths) == 0 {
+		if len(serviceToPaths[serviceId]) == 0 {
 			this.libConfig.GetLogger().Warn("missing path for service in serviceInfosToNodeInputs() --> skip service", "serviceId", serviceId)
 			continue
 		}
+		paths, err := strategy.apply(serviceToPaths[serviceId])
+		if err != nil {
+			return result, err
+		}
+		if len(paths) == 0 {
+			this.libConfig.GetLogger().Warn("no path of service matches path strategy in serviceInfosToNodeInputs() --> skip service", "serviceId", serviceId, "strategy", strategy.Name)
+			continue
+		}
 		values := []NodeValue{}
-		if this.config.EnableMultiplePaths {
-			for _, path := range paths {
-				values = append(values, NodeValue{
-					Name: inputPort,
-					Path: this.config.GroupPathPrefix + path,
-				})
-			}
-		} else {
-			values = []NodeValue{{
-				Name: inputPort,
-				Path: this.config.GroupPathPrefix + paths[0],
-			}}
+		for _, path := range paths {
+			values = append(values, NodeValue{
+				Name:             inputPort,
+				Path:             this.config.GroupPathPrefix + path.Path,
+				CharacteristicId: path.CharacteristicId,
+			})
 		}
 
 		result = append(result, NodeInput{
@@ -471,36 +774,57 @@ func (this *Analytics) serviceInfosToNodeInputs(serviceIds []string, serviceToDe
 			Values:     values,
 		})
 	}
-	return result
+	return result, nil
 }
 
-func (this *Analytics) importSelectionToNodeInputs(token auth.Token, selection model.ImportSelection, inputPort string) (result []NodeInput, err error) {
+func (this *Analytics) importSelectionToNodeInputs(ctx context.Context, token auth.Token, selection model.ImportSelection, task model.CamundaExternalTask, inputId string, portName string, state *taskState) (result []NodeInput, err error) {
 	if selection.Id == "" {
 		return result, errors.New("expect import selection to contain id")
 	}
-	if selection.Path == nil {
-		return result, errors.New("expect import selection to contain path")
+	importInstance, ok := state.importInstances[selection.Id]
+	if !ok {
+		importInstance, err = this.imports.GetImport(ctx, token, selection.Id)
+		if err != nil {
+			return result, fmt.Errorf("unable to get topic for import (%v): %w", selection.Id, err)
+		}
 	}
-	topic, err := this.imports.GetTopic(token, selection.Id)
-	if err != nil {
-		return result, fmt.Errorf("unable to get topic for import (%v): %w", selection.Id, err)
+	if importInstance.KafkaTopic == "" {
+		return result, fmt.Errorf("import %v is not deployed (missing kafka topic)", selection.Id)
 	}
-	path := *selection.Path
-	if this.config.RemoveImportPathRoot {
-		_, temp, found := strings.Cut(path, ".")
-		if found {
-			path = temp
+	state.addImport(importInstance)
+	paths := []servicePath{}
+	if selection.Path != nil {
+		paths = append(paths, servicePath{Path: *selection.Path, CharacteristicId: derefString(selection.CharacteristicId)})
+	} else {
+		paths, err = this.getImportPathsForCriteria(ctx, token, task, importInstance, derefString(selection.CharacteristicId), inputId, portName)
+		if err != nil {
+			return result, err
+		}
+		if len(paths) == 0 {
+			this.libConfig.GetLogger().Warn("no path of import matches criteria --> skip import", "importId", selection.Id, "importTypeId", importInstance.ImportTypeId)
+			return result, nil
 		}
 	}
-	path = this.config.ImportPathPrefix + path
+	values := []NodeValue{}
+	for _, p := range paths {
+		path := p.Path
+		if this.config.RemoveImportPathRoot {
+			_, temp, found := strings.Cut(path, ".")
+			if found {
+				path = temp
+			}
+		}
+		values = append(values, NodeValue{
+			Name:             portName,
+			Path:             this.config.ImportPathPrefix + path,
+			CharacteristicId: p.CharacteristicId,
+		})
+	}
 	return []NodeInput{{
 		FilterIds:  selection.Id,
 		FilterType: ImportFilterType,
-		TopicName:  topic,
-		Values: []NodeValue{{
-			Name: inputPort,
-			Path: path,
-		}},
+		TopicName:  importInstance.KafkaTopic,
+		Values:     values,
 	}}, nil
 }
 
@@ -545,3 +869,10 @@ func ServiceIdToTopic(id string) string {
 	id = strings.ReplaceAll(id, ":", "_")
 	return id
 }
+
+func derefString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+func TestRetryTransient(t *testing.T) {
+	transient := &UpstreamError{Upstream: UpstreamDeviceRepository, StatusCode: http.StatusServiceUnavailable, Kind: ErrUpstreamUnavailable}
+	permanent := &UpstreamError{Upstream: UpstreamFlowEngine, StatusCode: http.StatusBadRequest, Kind: ErrInvalidPipeline}
+	handler := newTestAnalytics(t, Config{TaskRetryBackoff: "1ms", TaskRetryMaxBackoff: "5ms"}, nil)
+
+	t.Run("success after transient errors", func(t *testing.T) {
+		calls := 0
+		err := handler.retryTransient(context.Background(), "pid", func() error {
+			calls++
+			switch calls {
+			case 1:
+				return transient
+			case 2:
+				//import lookups join and wrap the upstream errors
+				return fmt.Errorf("unable to get imports (a, b): %w", errors.Join(nil, transient))
+			default:
+				return nil
+			}
+		})
+		if err != nil || calls != 3 {
+			t.Error(err, calls)
+		}
+	})
+
+	t.Run("permanent error", func(t *testing.T) {
+		calls := 0
+		err := handler.retryTransient(context.Background(), "pid", func() error {
+			calls++
+			if calls == 1 {
+				return transient
+			}
+			return permanent
+		})
+		if !errors.Is(err, ErrInvalidPipeline) || calls != 2 {
+			t.Error(err, calls)
+		}
+	})
+
+	t.Run("invalid parameter", func(t *testing.T) {
+		calls := 0
+		err := handler.retryTransient(context.Background(), "pid", func() error {
+			calls++
+			return errors.New("invalid parameter")
+		})
+		if err == nil || calls != 1 {
+			t.Error(err, calls)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		handler := newTestAnalytics(t, Config{TaskRetryBackoff: "20ms", TaskRetryMaxBackoff: "50ms"}, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		calls := 0
+		err := handler.retryTransient(ctx, "pid", func() error {
+			calls++
+			return transient
+		})
+		if !IsTransientError(err) || calls < 2 {
+			t.Error(err, calls)
+		}
+		if ctx.Err() != nil {
+			t.Error("expected retries to stop before the deadline")
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		handler := newTestAnalytics(t, Config{TaskRetryBackoff: "1m", TaskRetryMaxBackoff: "1m"}, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		start := time.Now()
+		err := handler.retryTransient(ctx, "pid", func() error {
+			calls++
+			cancel()
+			return transient
+		})
+		if !IsTransientError(err) || calls != 1 || time.Since(start) > 10*time.Second {
+			t.Error(err, calls, time.Since(start))
+		}
+	})
+}
+
+type testAuth struct{}
+
+func (this testAuth) ExchangeUserToken(userid string) (token auth.Token, err error) {
+	return token, nil
+}
+
+type testSmartServiceRepo struct{}
+
+func (this testSmartServiceRepo) GetInstanceUser(instanceId string) (userId string, err error) {
+	return "user", nil
+}
+
+func (this testSmartServiceRepo) ListExistingModules(processInstanceId string, query model.ModulQuery) (result []model.SmartServiceModule, err error) {
+	return result, nil
+}
+
+func (this testSmartServiceRepo) SendWorkerModules(modules []model.Module) (result []model.SmartServiceModule, err error) {
+	return result, nil
+}
+
+// TestDoCancel stops the handler while the flow parser blocks the first request of the task
+func TestDoCancel(t *testing.T) {
+	requests := &atomic.Int64{}
+	received := make(chan struct{}, 10)
+	flowParser := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		received <- struct{}{}
+		<-request.Context().Done()
+	}))
+	defer flowParser.Close()
+
+	libConfig, err := configuration.LoadLibConfig("../../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{WorkerParamPrefix: "analytics.", FlowParserUrl: flowParser.URL, TaskRetryBackoff: "1ms", TaskRetryMaxBackoff: "5ms"}
+	client := httpclient.New(httpclient.NewTransport(), httpclient.Config{Timeout: time.Minute, MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := New(ctx, config, libConfig, testAuth{}, testSmartServiceRepo{}, nil, nil, nil, client)
+
+	task := model.CamundaExternalTask{
+		ProcessInstanceId: "process-instance-1",
+		Variables: map[string]model.CamundaVariable{
+			"analytics.flow_id": {Value: "flow-id-1"},
+		},
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := handler.Do(task)
+		done <- err
+	}()
+
+	select {
+	case <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("flow parser not requested")
+	}
+	cancel()
+
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Error("expected error")
+		}
+		if IsTransientError(err) {
+			t.Error("expected non transient error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Do did not return after cancellation")
+	}
+	if count := requests.Load(); count != 1 {
+		t.Error("expected 1 flow parser request, got", count)
+	}
+}
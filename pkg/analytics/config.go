@@ -16,20 +16,146 @@
 
 package analytics
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
+)
+
 type Config struct {
 	WorkerParamPrefix   string `json:"worker_param_prefix"`
 	FlowEngineUrl       string `json:"flow_engine_url"`
 	FlowParserUrl       string `json:"flow_parser_url"`
 	ImportDeployUrl     string `json:"import_deploy_url"`
+	ImportRepositoryUrl string `json:"import_repository_url"`
 	DeviceRepositoryUrl string `json:"device_repository_url"`
 	Debug               bool   `json:"debug"`
 
-	EnableMultiplePaths bool   `json:"enable_multiple_paths"`
+	DeviceLookupChunkSize   int `json:"device_lookup_chunk_size"`
+	DeviceLookupParallelism int `json:"device_lookup_parallelism"`
+
+	DeviceCacheTtl  string `json:"device_cache_ttl"` //empty to disable the device repository cache
+	DeviceCacheSize int    `json:"device_cache_size"`
+	ImportCacheTtl  string `json:"import_cache_ttl"` //empty to disable the import cache
+	ImportCacheSize int    `json:"import_cache_size"`
+
+	HttpTimeout             string `json:"http_timeout"`              //default timeout of a single upstream request
+	FlowEngineTimeout       string `json:"flow_engine_timeout"`       //empty to use http_timeout
+	FlowParserTimeout       string `json:"flow_parser_timeout"`       //empty to use http_timeout
+	DeviceRepositoryTimeout string `json:"device_repository_timeout"` //empty to use http_timeout
+	ImportTimeout           string `json:"import_timeout"`            //empty to use http_timeout; used for import-deploy and import-repository
+	HttpMaxRetries          int    `json:"http_max_retries"`          //retries of idempotent requests, 0 to disable
+	HttpRetryBackoff        string `json:"http_retry_backoff"`        //backoff before the first retry, doubled for every further retry
+	HttpRetryMaxBackoff     string `json:"http_retry_max_backoff"`
+
+	TaskRetryBackoff    string `json:"task_retry_backoff"` //backoff before the first retry of a task with transient errors, doubled for every further retry
+	TaskRetryMaxBackoff string `json:"task_retry_max_backoff"`
+
+	EnableMultiplePaths bool   `json:"enable_multiple_paths"` //default path strategy: "all" if true, "first" if false
 	DevicePathPrefix    string `json:"device_path_prefix"`
 	GroupPathPrefix     string `json:"group_path_prefix"`
 	ImportPathPrefix    string `json:"import_path_prefix"`
 
 	RemoveImportPathRoot bool `json:"remove_import_path_root"`
 
+	StrictNodeConfig bool `json:"strict_node_config"`
+
+	MaxWindowTime string `json:"max_window_time"`
+
+	MergeStrategies []string `json:"merge_strategies"`
+
 	HealthCheckInterval string `json:"health_check_interval"`
+	ReconcileInterval   string `json:"reconcile_interval"` //empty to disable the reconciliation of keyed pipelines
+}
+
+// GetMaxWindowTime returns 0 if no maximum is configured
+func (this Config) GetMaxWindowTime() (time.Duration, error) {
+	if this.MaxWindowTime == "" {
+		return 0, nil
+	}
+	result, err := time.ParseDuration(this.MaxWindowTime)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max_window_time config: %w", err)
+	}
+	return result, nil
+}
+
+// GetDeviceCacheTtl returns 0 if the device repository cache is disabled
+func (this Config) GetDeviceCacheTtl() (time.Duration, error) {
+	return parseOptionalDuration("device_cache_ttl", this.DeviceCacheTtl)
+}
+
+// GetImportCacheTtl returns 0 if the import cache is disabled
+func (this Config) GetImportCacheTtl() (time.Duration, error) {
+	return parseOptionalDuration("import_cache_ttl", this.ImportCacheTtl)
+}
+
+// parseOptionalDuration returns 0 for an empty value
+func parseOptionalDuration(field string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v config: %w", field, err)
+	}
+	return result, nil
+}
+
+// GetHttpClientConfig returns the client config of an upstream with the given timeout config value
+func (this Config) GetHttpClientConfig(upstreamTimeout string) (result httpclient.Config, err error) {
+	timeout := upstreamTimeout
+	if timeout == "" {
+		timeout = this.HttpTimeout
+	}
+	result.Timeout, err = parseOptionalDuration("http timeout", timeout)
+	if err != nil {
+		return result, err
+	}
+	result.InitialBackoff, err = parseOptionalDuration("http_retry_backoff", this.HttpRetryBackoff)
+	if err != nil {
+		return result, err
+	}
+	result.MaxBackoff, err = parseOptionalDuration("http_retry_max_backoff", this.HttpRetryMaxBackoff)
+	if err != nil {
+		return result, err
+	}
+	result.MaxRetries = this.HttpMaxRetries
+	return result, nil
+}
+
+const DefaultTaskRetryBackoff = time.Second
+const DefaultTaskRetryMaxBackoff = 30 * time.Second
+
+// GetTaskRetryBackoff returns the backoff config of tasks with transient errors
+// tasks are retried until the task deadline (derived from the camunda lock duration) would be exceeded
+func (this Config) GetTaskRetryBackoff() (initial time.Duration, max time.Duration, err error) {
+	initial, err = parseOptionalDuration("task_retry_backoff", this.TaskRetryBackoff)
+	if err != nil {
+		return initial, max, err
+	}
+	max, err = parseOptionalDuration("task_retry_max_backoff", this.TaskRetryMaxBackoff)
+	if err != nil {
+		return initial, max, err
+	}
+	if initial <= 0 {
+		initial = DefaultTaskRetryBackoff
+	}
+	if max <= 0 {
+		max = DefaultTaskRetryMaxBackoff
+	}
+	return initial, max, nil
+}
+
+const DefaultMergeStrategy = "inner"
+
+var DefaultMergeStrategies = []string{"inner", "outer"}
+
+// GetMergeStrategies returns the merge strategies supported by the flow engine
+func (this Config) GetMergeStrategies() []string {
+	if len(this.MergeStrategies) == 0 {
+		return DefaultMergeStrategies
+	}
+	return this.MergeStrategies
 }
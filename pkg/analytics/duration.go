@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WindowTimeUnit is the unit in which the flow engine expects the window time
+const WindowTimeUnit = time.Second
+
+// parseWindowTime interprets a window time value
+// numbers (and strings containing integers) are expected to already be in WindowTimeUnit
+// other strings are interpreted as go duration (e.g. "5m", "1h30m") or ISO-8601 duration (e.g. "PT30S", "P1D")
+// the result is validated against 0 <= result <= maxWindowTime (if maxWindowTime > 0)
+func parseWindowTime(value interface{}, maxWindowTime time.Duration) (result int, err error) {
+	var duration time.Duration
+	switch v := value.(type) {
+	case int:
+		duration, err = windowTimeUnits(int64(v))
+	case int32:
+		duration, err = windowTimeUnits(int64(v))
+	case int64:
+		duration, err = windowTimeUnits(v)
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("expected integer or duration, got %v", v)
+		}
+		if math.Abs(v) > float64(math.MaxInt64/int64(WindowTimeUnit)) {
+			return 0, fmt.Errorf("%v exceeds the maximum duration", v)
+		}
+		duration, err = windowTimeUnits(int64(v))
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return 0, nil
+		}
+		if temp, parseErr := strconv.ParseInt(v, 10, 64); parseErr == nil {
+			duration, err = windowTimeUnits(temp)
+		} else if errors.Is(parseErr, strconv.ErrRange) {
+			return 0, fmt.Errorf("%v exceeds the maximum duration", v)
+		} else {
+			duration, err = parseDuration(v)
+		}
+	default:
+		return 0, fmt.Errorf("expected integer or duration, got %v", value)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("must not be negative (%v)", duration)
+	}
+	if maxWindowTime > 0 && duration > maxWindowTime {
+		return 0, fmt.Errorf("%v exceeds the maximum of %v", duration, maxWindowTime)
+	}
+	if duration%WindowTimeUnit != 0 {
+		return 0, fmt.Errorf("%v is not a multiple of %v", duration, WindowTimeUnit)
+	}
+	return int(duration / WindowTimeUnit), nil
+}
+
+// windowTimeUnits converts a number of WindowTimeUnit to a duration, without overflowing
+func windowTimeUnits(value int64) (time.Duration, error) {
+	if value > math.MaxInt64/int64(WindowTimeUnit) || value < math.MinInt64/int64(WindowTimeUnit) {
+		return 0, fmt.Errorf("%v exceeds the maximum duration", value)
+	}
+	return time.Duration(value) * WindowTimeUnit, nil
+}
+
+// parseDuration accepts go durations (e.g. "10m") and ISO-8601 durations without years and months (e.g. "PT10M", "P1DT12H")
+func parseDuration(value string) (time.Duration, error) {
+	if strings.HasPrefix(strings.ToUpper(value), "P") {
+		return parseIsoDuration(value)
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("expected integer, go duration (e.g. 10m) or ISO-8601 duration (e.g. PT10M), got %v", value)
+	}
+	return result, nil
+}
+
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+func parseIsoDuration(value string) (result time.Duration, err error) {
+	value = strings.ToUpper(value)
+	match := isoDurationRegex.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, errors.New("invalid ISO-8601 duration (years and months are not supported): " + value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	for i, unit := range units {
+		part := match[i+1]
+		if part == "" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO-8601 duration %v: %w", value, err)
+		}
+		if amount*float64(unit) >= float64(math.MaxInt64-result) {
+			return 0, fmt.Errorf("ISO-8601 duration %v exceeds the maximum duration", value)
+		}
+		result = result + time.Duration(amount*float64(unit))
+	}
+	return result, nil
+}
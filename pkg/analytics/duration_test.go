@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseWindowTime(t *testing.T) {
+	for _, tc := range []struct {
+		value    interface{}
+		max      time.Duration
+		expected int
+		err      bool
+	}{
+		//numbers and integer strings in WindowTimeUnit
+		{value: float64(30), expected: 30},
+		{value: 30, expected: 30},
+		{value: int32(30), expected: 30},
+		{value: int64(30), expected: 30},
+		{value: "30", expected: 30},
+		{value: " 30 ", expected: 30},
+		{value: "", expected: 0},
+		{value: float64(0), expected: 0},
+		{value: 1.5, err: true},
+		{value: true, err: true},
+
+		//go durations
+		{value: "5m", expected: 300},
+		{value: "1h30m", expected: 5400},
+		{value: "1500ms", err: true}, //not a multiple of the unit
+		{value: "10x", err: true},
+
+		//ISO-8601 durations
+		{value: "PT30S", expected: 30},
+		{value: "pt10m", expected: 600},
+		{value: "P1D", expected: 86400},
+		{value: "P1W", expected: 604800},
+		{value: "P1DT12H", expected: 129600},
+		{value: "PT1.5S", err: true}, //not a multiple of the unit
+		{value: "PT30.0S", expected: 30},
+		{value: "P", err: true},
+		{value: "PT", err: true},
+		{value: "P1Y", err: true},
+		{value: "P1M", err: true},
+
+		//negative values
+		{value: float64(-1), err: true},
+		{value: -1, err: true},
+		{value: "-1", err: true},
+		{value: "-5m", err: true},
+
+		//overflow
+		{value: 1e10, err: true},
+		{value: float64(-1e10), err: true},
+		{value: int64(1e10), err: true},
+		{value: "10000000000", err: true},
+		{value: "99999999999999999999", err: true},
+		{value: "P99999999999W", err: true},
+		{value: "PT9999999999H", err: true},
+		{value: "P15000WT2562047H", err: true}, //each part fits, the sum does not
+		{value: "3000000h", err: true},
+
+		//maximum
+		{value: "1h", max: time.Hour, expected: 3600},
+		{value: "PT1H1S", max: time.Hour, err: true},
+		{value: float64(3601), max: time.Hour, err: true},
+	} {
+		result, err := parseWindowTime(tc.value, tc.max)
+		if (err != nil) != tc.err {
+			t.Errorf("%#v: unexpected error %v", tc.value, err)
+			continue
+		}
+		if err == nil && result != tc.expected {
+			t.Errorf("%#v: expected %v, got %v", tc.value, tc.expected, result)
+		}
+	}
+}
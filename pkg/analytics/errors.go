@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"errors"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/imports"
+)
+
+const (
+	UpstreamFlowEngine       = "flow-engine"
+	UpstreamFlowParser       = "flow-parser"
+	UpstreamDeviceRepository = devices.UpstreamDeviceRepository
+	UpstreamImportDeploy     = imports.UpstreamImportDeploy
+	UpstreamImportRepository = imports.UpstreamImportRepository
+)
+
+var (
+	ErrFlowNotFound        = errors.New("flow not found")
+	ErrForbidden           = httpclient.ErrForbidden
+	ErrUpstreamUnavailable = httpclient.ErrUpstreamUnavailable
+	ErrInvalidPipeline     = errors.New("invalid pipeline")
+)
+
+// UpstreamErrorBodyLimit is the maximum number of response body bytes kept in UpstreamError.Body
+const UpstreamErrorBodyLimit = httpclient.UpstreamErrorBodyLimit
+
+// UpstreamError describes a failed request to an upstream service (see httpclient.UpstreamError)
+// the device-repository and import clients return the same type
+type UpstreamError = httpclient.UpstreamError
+
+var newUpstreamResponseError = httpclient.NewResponseError
+var newUpstreamRequestError = httpclient.NewRequestError
+
+// IsTransientError returns true if err may disappear if the request is repeated later (ErrUpstreamUnavailable)
+// all other errors (e.g. invalid parameters, ErrFlowNotFound, ErrForbidden, ErrInvalidPipeline) need user interaction
+func IsTransientError(err error) bool {
+	return httpclient.IsTransientError(err)
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+)
+
+const (
+	ExcludedReasonNoMatchingService         = "no_matching_service"
+	ExcludedReasonNoEventService            = "no_event_service"
+	ExcludedReasonFilteredByServiceCriteria = "filtered_by_service_criteria"
+	ExcludedReasonNotReadable               = "not_readable"
+)
+
+// ExcludedDevice is a selected device (e.g. a device-group member) that is not part of the pipeline
+type ExcludedDevice struct {
+	Port         string   `json:"port"` //{{inputId}}.{{portName}}
+	DeviceId     string   `json:"device_id"`
+	DeviceName   string   `json:"device_name,omitempty"`
+	DeviceTypeId string   `json:"device_type_id,omitempty"`
+	Reason       string   `json:"reason"`
+	ServiceIds   []string `json:"service_ids,omitempty"` //request services matching the criteria, set for ExcludedReasonNoEventService
+}
+
+// completeDeviceExclusions sets the port of the excluded devices
+// and explains why devices without matching service are excluded (ExcludedReasonNoMatchingService or ExcludedReasonNoEventService with the matching request services)
+// the device repository is only asked for request services if a device has no matching service
+func (this *Analytics) completeDeviceExclusions(ctx context.Context, token auth.Token, criteria []devices.FilterCriteria, excluded []ExcludedDevice, port string, state *taskState) (result []ExcludedDevice, err error) {
+	var requestSelectables []devices.DeviceTypeSelectable
+	if slices.ContainsFunc(excluded, func(device ExcludedDevice) bool {
+		return device.Reason == ExcludedReasonNoMatchingService
+	}) {
+		requestCriteria := []devices.FilterCriteria{}
+		for _, c := range criteria {
+			c.Interaction = devices.REQUEST
+			requestCriteria = append(requestCriteria, c)
+		}
+		requestSelectables, err = state.devices.GetDeviceTypeSelectables(ctx, token, requestCriteria, true, true)
+		if err != nil {
+			this.libConfig.GetLogger().Error("unable to find device type selectables", "error", err)
+			return result, err
+		}
+	}
+	for _, device := range excluded {
+		device.Port = port
+		if device.Reason == ExcludedReasonNoMatchingService {
+			for _, selectable := range requestSelectables {
+				if selectable.DeviceTypeId == device.DeviceTypeId {
+					for serviceId := range selectable.ServicePathOptions {
+						device.ServiceIds = append(device.ServiceIds, serviceId)
+					}
+				}
+			}
+			if len(device.ServiceIds) > 0 {
+				device.Reason = ExcludedReasonNoEventService
+				slices.Sort(device.ServiceIds)
+			}
+		}
+		result = append(result, device)
+	}
+	return result, nil
+}
+
+// getFilteredDeviceExclusions returns the devices of before, that are no longer referenced in after
+func getFilteredDeviceExclusions(before map[string][]string, after map[string][]string, port string) (result []ExcludedDevice) {
+	remaining := map[string]bool{}
+	for _, deviceIds := range after {
+		for _, id := range deviceIds {
+			remaining[id] = true
+		}
+	}
+	seen := map[string]bool{}
+	for _, deviceIds := range before {
+		for _, id := range deviceIds {
+			if !remaining[id] && !seen[id] {
+				seen[id] = true
+				result = append(result, ExcludedDevice{
+					Port:     port,
+					DeviceId: id,
+					Reason:   ExcludedReasonFilteredByServiceCriteria,
+				})
+			}
+		}
+	}
+	slices.SortFunc(result, func(a, b ExcludedDevice) int {
+		return strings.Compare(a.DeviceId, b.DeviceId)
+	})
+	return result
+}
+
+// describeRequestOnlyDevices lists devices excluded with ExcludedReasonNoEventService and their request services
+// e.g. "d1 in input.port (services: s1, s2), lamp (d2) in input.port (services: s3)"
+func describeRequestOnlyDevices(excluded []ExcludedDevice) string {
+	descriptions := []string{}
+	for _, device := range excluded {
+		name := device.DeviceId
+		if device.DeviceName != "" && device.DeviceName != device.DeviceId {
+			name = device.DeviceName + " (" + device.DeviceId + ")"
+		}
+		descriptions = append(descriptions, name+" in "+device.Port+" (services: "+strings.Join(device.ServiceIds, ", ")+")")
+	}
+	return strings.Join(descriptions, ", ")
+}
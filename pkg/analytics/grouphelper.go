@@ -17,58 +17,121 @@
 package analytics
 
 import (
+	"context"
+	"slices"
+
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
 )
 
-func (this *Analytics) getServicesAndPathsForGroupSelection(token auth.Token, selection model.DeviceGroupSelection, criteria []devices.FilterCriteria) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]string, err error) {
-	devices, deviceTypeIds, err := this.devices.GetDeviceInfosOfGroup(token, selection.Id)
+// servicePath is a json path of a service output with the characteristic and aspect of the value found at the path
+type servicePath struct {
+	Path             string
+	CharacteristicId string
+	AspectId         string
+}
+
+func (this *Analytics) getServicesAndPathsForGroupSelection(ctx context.Context, token auth.Token, selection model.DeviceGroupSelection, criteria []devices.FilterCriteria, state *taskState) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]servicePath, excluded []ExcludedDevice, err error) {
+	group, err := state.devices.GetDeviceGroup(ctx, token, selection.Id)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
-	return this.getServicesAndPathsForDevices(token, devices, deviceTypeIds, criteria)
+	state.addDeviceGroup(group)
+	return this.getServicesAndPathsForDeviceIdList(ctx, token, group.DeviceIds, criteria, state)
 }
 
-func (this *Analytics) getServicesAndPathsForDeviceIdList(token auth.Token, deviceIds []string, criteria []devices.FilterCriteria) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]string, err error) {
-	devices, deviceTypeIds, err := this.devices.GetDeviceInfosOfDevices(token, deviceIds)
+func (this *Analytics) getServicesAndPathsForDeviceIdList(ctx context.Context, token auth.Token, deviceIds []string, criteria []devices.FilterCriteria, state *taskState) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]servicePath, excluded []ExcludedDevice, err error) {
+	devices, deviceTypeIds, unreadableDeviceIds, err := state.devices.GetDeviceInfosOfDevices(ctx, token, deviceIds)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
+	}
+	serviceIds, serviceToDevices, serviceToPath, excluded, err = this.getServicesAndPathsForDevices(ctx, token, devices, deviceTypeIds, criteria, state)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	for _, id := range unreadableDeviceIds {
+		excluded = append(excluded, ExcludedDevice{DeviceId: id, Reason: ExcludedReasonNotReadable})
 	}
-	return this.getServicesAndPathsForDevices(token, devices, deviceTypeIds, criteria)
+	return serviceIds, serviceToDevices, serviceToPath, excluded, nil
 }
 
-func (this *Analytics) getServicesAndPathsForDevices(token auth.Token, deviceList []devices.Device, deviceTypeIds []string, criteria []devices.FilterCriteria) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]string, err error) {
-	options, err := this.getDeviceGroupPathOptions(token, criteria, deviceTypeIds)
+// getServicesAndPathsForCriteria finds all devices of the user with a service matching the criteria
+func (this *Analytics) getServicesAndPathsForCriteria(ctx context.Context, token auth.Token, criteria []devices.FilterCriteria, state *taskState) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]servicePath, err error) {
+	options, err := this.getDeviceGroupPathOptions(ctx, token, criteria, nil, state)
 	if err != nil {
 		this.libConfig.GetLogger().Error("unable to find path options", "error", err)
 		return nil, nil, nil, err
 	}
+	deviceTypeIds := []string{}
+	for dtId := range options {
+		deviceTypeIds = append(deviceTypeIds, dtId)
+	}
+	if len(deviceTypeIds) == 0 {
+		return []string{}, map[string][]string{}, map[string][]servicePath{}, nil
+	}
+	slices.Sort(deviceTypeIds)
+	deviceList, err := state.devices.GetDevicesOfDeviceTypes(ctx, token, deviceTypeIds)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	serviceIds, serviceToDevices, serviceToPath = getServicesAndPathsFromOptions(deviceList, options)
+	return serviceIds, serviceToDevices, serviceToPath, nil
+}
+
+// getServicesAndPathsForDevices returns the services and paths of the devices matching the criteria
+// excluded contains all devices without a matching service (ExcludedReasonNoMatchingService, without port)
+func (this *Analytics) getServicesAndPathsForDevices(ctx context.Context, token auth.Token, deviceList []devices.Device, deviceTypeIds []string, criteria []devices.FilterCriteria, state *taskState) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]servicePath, excluded []ExcludedDevice, err error) {
+	options, err := this.getDeviceGroupPathOptions(ctx, token, criteria, deviceTypeIds, state)
+	if err != nil {
+		this.libConfig.GetLogger().Error("unable to find path options", "error", err)
+		return nil, nil, nil, nil, err
+	}
+	serviceIds, serviceToDevices, serviceToPath = getServicesAndPathsFromOptions(deviceList, options)
+	for _, device := range deviceList {
+		if !slices.ContainsFunc(options[device.DeviceTypeId], func(option devices.PathOptionsResultElement) bool {
+			return len(option.JsonPath) > 0
+		}) {
+			excluded = append(excluded, ExcludedDevice{
+				DeviceId:     device.Id,
+				DeviceName:   device.Name,
+				DeviceTypeId: device.DeviceTypeId,
+				Reason:       ExcludedReasonNoMatchingService,
+			})
+		}
+	}
+	return serviceIds, serviceToDevices, serviceToPath, excluded, nil
+}
+
+func getServicesAndPathsFromOptions(deviceList []devices.Device, options map[string][]devices.PathOptionsResultElement) (serviceIds []string, serviceToDevices map[string][]string, serviceToPath map[string][]servicePath) {
 	serviceIds = []string{}
 	serviceToDevices = map[string][]string{}
-	serviceToPath = map[string][]string{}
-	serviceToPathToCharacteristic := map[string]map[string]string{}
+	serviceToPath = map[string][]servicePath{}
 	for _, device := range deviceList {
 		for _, option := range options[device.DeviceTypeId] {
 			if len(option.JsonPath) > 0 {
 				serviceToDevices[option.ServiceId] = append(serviceToDevices[option.ServiceId], device.Id)
-				if _, ok := serviceToPath[option.ServiceId]; !ok {
-					serviceIds = append(serviceIds, option.ServiceId)
+				if _, ok := serviceToPath[option.ServiceId]; ok {
+					//paths of a service are the same for every device of the device-type
+					continue
 				}
+				serviceIds = append(serviceIds, option.ServiceId)
 				for _, path := range option.JsonPath {
-					serviceToPath[option.ServiceId] = append(serviceToPath[option.ServiceId], path)
-					if _, ok := serviceToPathToCharacteristic[option.ServiceId]; !ok {
-						serviceToPathToCharacteristic[option.ServiceId] = map[string]string{}
-					}
-					serviceToPathToCharacteristic[option.ServiceId][path] = option.PathToCharacteristicId[path]
+					serviceToPath[option.ServiceId] = append(serviceToPath[option.ServiceId], servicePath{
+						Path:             path,
+						CharacteristicId: option.PathToCharacteristicId[path],
+						AspectId:         option.PathToAspectId[path],
+					})
 				}
 			}
 		}
 	}
-	return serviceIds, serviceToDevices, serviceToPath, nil
+	return serviceIds, serviceToDevices, serviceToPath
 }
 
-func (this *Analytics) getDeviceGroupPathOptions(token auth.Token, criteria []devices.FilterCriteria, deviceTypeIds []string) (result map[string][]devices.PathOptionsResultElement, err error) {
+// getDeviceGroupPathOptions returns the path options of the given device-types matching the criteria
+// if deviceTypeIds is nil, the path options of all matching device-types are returned
+func (this *Analytics) getDeviceGroupPathOptions(ctx context.Context, token auth.Token, criteria []devices.FilterCriteria, deviceTypeIds []string, state *taskState) (result map[string][]devices.PathOptionsResultElement, err error) {
 	result = map[string][]devices.PathOptionsResultElement{}
 	for i, c := range criteria {
 		if c.Interaction == "" {
@@ -76,11 +139,18 @@ func (this *Analytics) getDeviceGroupPathOptions(token auth.Token, criteria []de
 		}
 		criteria[i] = c
 	}
-	selectables, err := this.devices.GetDeviceTypeSelectables(token, criteria, true, true)
+	selectables, err := state.devices.GetDeviceTypeSelectables(ctx, token, criteria, true, true)
 	if err != nil {
 		this.libConfig.GetLogger().Error("unable to find device type selectables", "error", err)
 		return result, err
 	}
+	if deviceTypeIds == nil {
+		for _, selectable := range selectables {
+			if !slices.Contains(deviceTypeIds, selectable.DeviceTypeId) {
+				deviceTypeIds = append(deviceTypeIds, selectable.DeviceTypeId)
+			}
+		}
+	}
 	for _, dtId := range deviceTypeIds {
 		for _, selectable := range selectables {
 			if selectable.DeviceTypeId == dtId {
@@ -89,11 +159,13 @@ func (this *Analytics) getDeviceGroupPathOptions(token auth.Token, criteria []de
 						ServiceId:              sid,
 						JsonPath:               []string{},
 						PathToCharacteristicId: map[string]string{},
+						PathToAspectId:         map[string]string{},
 					}
 					for _, option := range options {
 						if option.ServiceId == sid {
 							temp.JsonPath = append(temp.JsonPath, option.Path)
 							temp.PathToCharacteristicId[option.Path] = option.CharacteristicId
+							temp.PathToAspectId[option.Path] = option.AspectNode.Id
 						} else {
 							this.libConfig.GetLogger().Warn("unexpected service id in ServicePathOptions")
 						}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const PipelineRequestHashField = "pipeline_request_hash"
+
+// HashPipelineRequest returns a hash of the canonical form of the request (see CanonicalPipelineRequest)
+// requests that differ only in their id or in the order of nodes, configs, inputs, values or filter ids have the same hash
+func HashPipelineRequest(request PipelineRequest) (string, error) {
+	temp, err := json.Marshal(CanonicalPipelineRequest(request))
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(temp)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// CanonicalPipelineRequest returns a deterministically ordered deep copy of the request without id
+func CanonicalPipelineRequest(request PipelineRequest) (result PipelineRequest) {
+	result = request
+	result.Id = ""
+	result.Nodes = []PipelineNode{}
+	for _, node := range request.Nodes {
+		canonicalNode := node
+		canonicalNode.Config = slices.Clone(node.Config)
+		sort.SliceStable(canonicalNode.Config, func(i, j int) bool {
+			return canonicalNode.Config[i].Name < canonicalNode.Config[j].Name
+		})
+		canonicalNode.Inputs = []NodeInput{}
+		for _, input := range node.Inputs {
+			canonicalInput := input
+			filterIds := strings.Split(input.FilterIds, ",")
+			sort.Strings(filterIds)
+			canonicalInput.FilterIds = strings.Join(filterIds, ",")
+			canonicalInput.Values = slices.Clone(input.Values)
+			sort.SliceStable(canonicalInput.Values, func(i, j int) bool {
+				return nodeValueSortKey(canonicalInput.Values[i]) < nodeValueSortKey(canonicalInput.Values[j])
+			})
+			canonicalNode.Inputs = append(canonicalNode.Inputs, canonicalInput)
+		}
+		sort.SliceStable(canonicalNode.Inputs, func(i, j int) bool {
+			return nodeInputSortKey(canonicalNode.Inputs[i]) < nodeInputSortKey(canonicalNode.Inputs[j])
+		})
+		result.Nodes = append(result.Nodes, canonicalNode)
+	}
+	sort.SliceStable(result.Nodes, func(i, j int) bool {
+		return result.Nodes[i].NodeId < result.Nodes[j].NodeId
+	})
+	return result
+}
+
+func nodeInputSortKey(input NodeInput) string {
+	return input.TopicName + "\x00" + input.FilterType + "\x00" + input.FilterIds
+}
+
+func nodeValueSortKey(value NodeValue) string {
+	return value.Name + "\x00" + value.Path
+}
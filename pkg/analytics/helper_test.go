@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
+)
+
+// shared helpers of the unit tests in this package
+
+func newTestAnalytics(t *testing.T, config Config, flowEngine *httpclient.Client) *Analytics {
+	t.Helper()
+	libConfig, err := configuration.LoadLibConfig("../../config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return New(ctx, config, libConfig, nil, nil, nil, nil, flowEngine, nil)
+}
+
+// countingDevices counts the calls per method
+type countingDevices struct {
+	mux   sync.Mutex
+	calls map[string]int
+}
+
+func (this *countingDevices) count(method string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.calls[method]++
+}
+
+func (this *countingDevices) GetDeviceGroup(ctx context.Context, token auth.Token, groupId string) (result devices.DeviceGroup, err error) {
+	this.count("GetDeviceGroup")
+	return devices.DeviceGroup{Id: groupId}, nil
+}
+
+func (this *countingDevices) GetDeviceInfosOfDevices(ctx context.Context, token auth.Token, deviceIds []string) (result []devices.Device, deviceTypeIds []string, unreadableDeviceIds []string, err error) {
+	this.count("GetDeviceInfosOfDevices")
+	return nil, nil, nil, nil
+}
+
+func (this *countingDevices) GetDevicesOfDeviceTypes(ctx context.Context, token auth.Token, deviceTypeIds []string) (result []devices.Device, err error) {
+	this.count("GetDevicesOfDeviceTypes")
+	return nil, nil
+}
+
+func (this *countingDevices) GetDeviceTypeSelectables(ctx context.Context, token auth.Token, criteria []devices.FilterCriteria, includeModified bool, servicesMustMatchAllCriteria bool) (result []devices.DeviceTypeSelectable, err error) {
+	this.count("GetDeviceTypeSelectables")
+	return nil, nil
+}
+
+// newFlowEngineMock counts the requests and answers them with handler
+func newFlowEngineMock(t *testing.T, handler http.HandlerFunc) (server *httptest.Server, requests *atomic.Int64) {
+	requests = &atomic.Int64{}
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests.Add(1)
+		handler(writer, request)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func respondWithStatus(status int) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(status)
+	}
+}
+
+// closeConnection reads the request and closes the connection without response,
+// like a flow engine that crashes after it received the pipeline
+func closeConnection(writer http.ResponseWriter, request *http.Request) {
+	conn, _, err := writer.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func newTestFlowEngineClient() *httpclient.Client {
+	return httpclient.New(httpclient.NewTransport(), httpclient.Config{Timeout: 200 * time.Millisecond, MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/imports"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// prefetchImports requests the import instances of all import selections of the task in one batch
+// invalid selections are ignored and reported when the port is resolved
+// if the batch request fails, the imports are requested per selection when the port is resolved
+func (this *Analytics) prefetchImports(ctx context.Context, token auth.Token, task model.CamundaExternalTask, inputs []FlowModelCell, state *taskState) {
+	importIds := []string{}
+	for _, input := range inputs {
+		for _, port := range input.InPorts {
+			selections, err := this.getSelections(task, input.Id, port)
+			if err != nil {
+				continue
+			}
+			for _, selection := range selections {
+				if selection.ImportSelection != nil && selection.ImportSelection.Id != "" {
+					importIds = append(importIds, selection.ImportSelection.Id)
+				}
+			}
+		}
+	}
+	if len(importIds) == 0 {
+		return
+	}
+	importInstances, err := this.imports.GetImports(ctx, token, importIds)
+	if err != nil {
+		this.libConfig.GetLogger().Warn("unable to prefetch imports --> request per selection", "processInstanceId", task.ProcessInstanceId, "importIds", importIds, "error", err)
+		return
+	}
+	state.importInstances = importInstances
+}
+
+// getImportPathsForCriteria returns the paths of the import output matching the criteria of the port
+// if characteristicId is set, only paths with this characteristic are returned
+// the port path strategy is applied to the result
+func (this *Analytics) getImportPathsForCriteria(ctx context.Context, token auth.Token, task model.CamundaExternalTask, importInstance imports.Import, characteristicId string, inputId string, portName string) (result []servicePath, err error) {
+	criteria, err := this.getNodePathCriteria(task, inputId, portName)
+	if err != nil {
+		return result, fmt.Errorf("import selection without path: %w", err)
+	}
+	strategy, err := this.getPathStrategy(task, inputId, portName, criteria)
+	if err != nil {
+		return result, err
+	}
+	if importInstance.ImportTypeId == "" {
+		return result, errors.New("unable to resolve import selection without path: missing import type of import " + importInstance.Id)
+	}
+	importType, err := this.imports.GetImportType(ctx, token, importInstance.ImportTypeId)
+	if err != nil {
+		return result, fmt.Errorf("unable to get import type (%v): %w", importInstance.ImportTypeId, err)
+	}
+	for _, path := range getContentVariablePaths(importType.Output, "") {
+		if characteristicId != "" && path.variable.CharacteristicId != characteristicId {
+			continue
+		}
+		if contentVariableMatchesCriteria(path.variable, criteria) {
+			result = append(result, servicePath{
+				Path:             path.path,
+				CharacteristicId: path.variable.CharacteristicId,
+				AspectId:         path.variable.AspectId,
+			})
+		}
+	}
+	return strategy.apply(result)
+}
+
+type contentVariablePath struct {
+	path     string
+	variable imports.ContentVariable
+}
+
+// getContentVariablePaths returns the leaf content variables of variable with their path (names joined by ".", starting with the name of variable)
+func getContentVariablePaths(variable imports.ContentVariable, parentPath string) (result []contentVariablePath) {
+	path := variable.Name
+	if parentPath != "" {
+		path = parentPath + "." + variable.Name
+	}
+	if len(variable.SubContentVariables) == 0 {
+		return []contentVariablePath{{path: path, variable: variable}}
+	}
+	for _, sub := range variable.SubContentVariables {
+		result = append(result, getContentVariablePaths(sub, path)...)
+	}
+	return result
+}
+
+// contentVariableMatchesCriteria returns true if the function and aspect of variable match at least one criteria
+// aspects are compared exactly, because import types do not reference the aspect hierarchy
+// interaction and device class are ignored
+func contentVariableMatchesCriteria(variable imports.ContentVariable, criteria []devices.FilterCriteria) bool {
+	for _, c := range criteria {
+		if c.FunctionId == "" && c.AspectId == "" {
+			continue
+		}
+		if (c.FunctionId == "" || c.FunctionId == variable.FunctionId) && (c.AspectId == "" || c.AspectId == variable.AspectId) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/imports"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// batchFailingImports fails every GetImports call, single imports are found
+type batchFailingImports struct{}
+
+func (this *batchFailingImports) GetImport(ctx context.Context, token auth.Token, importId string) (result imports.Import, err error) {
+	return imports.Import{Id: importId, KafkaTopic: "topic-" + importId}, nil
+}
+
+func (this *batchFailingImports) GetImports(ctx context.Context, token auth.Token, importIds []string) (result map[string]imports.Import, err error) {
+	return result, errors.New("batch failed")
+}
+
+func (this *batchFailingImports) GetImportType(ctx context.Context, token auth.Token, importTypeId string) (result imports.ImportType, err error) {
+	return result, errors.New("not implemented")
+}
+
+func TestPrefetchImportsFallback(t *testing.T) {
+	handler := newTestAnalytics(t, Config{WorkerParamPrefix: "analytics."}, nil)
+	handler.imports = &batchFailingImports{}
+	task := model.CamundaExternalTask{Variables: map[string]model.CamundaVariable{
+		"analytics.selection.node.port": {Value: `{"import_selection":{"id":"i1","path":"value.x"}}`},
+	}}
+	inputs := []FlowModelCell{{Id: "node", InPorts: []string{"port"}}}
+
+	nodes, err := handler.inputsToNodes(context.Background(), auth.Token{}, task, inputs, newTaskState(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || len(nodes[0].Inputs) != 1 || nodes[0].Inputs[0].TopicName != "topic-i1" {
+		t.Errorf("unexpected nodes %#v", nodes)
+	}
+}
@@ -30,10 +30,12 @@ type PipelineRequest struct {
 }
 
 type PipelineNode struct {
-	NodeId      string       `json:"nodeId,omitempty"`
-	Inputs      []NodeInput  `json:"inputs,omitempty"`
-	Config      []NodeConfig `json:"config,omitempty"`
-	PersistData bool         `json:"persistData,omitempty"`
+	NodeId        string       `json:"nodeId,omitempty"`
+	Inputs        []NodeInput  `json:"inputs,omitempty"`
+	Config        []NodeConfig `json:"config,omitempty"`
+	PersistData   bool         `json:"persistData,omitempty"`
+	WindowTime    *int         `json:"windowTime,omitempty"`    //overrides PipelineRequest.WindowTime for this node
+	MergeStrategy string       `json:"mergeStrategy,omitempty"` //overrides PipelineRequest.MergeStrategy for this node
 }
 
 type NodeConfig struct {
@@ -52,8 +54,10 @@ type NodeInput struct {
 }
 
 type NodeValue struct {
-	Name string `json:"name,omitempty"`
-	Path string `json:"path,omitempty"`
+	Name                   string `json:"name,omitempty"`
+	Path                   string `json:"path,omitempty"`
+	CharacteristicId       string `json:"characteristicId,omitempty"`
+	TargetCharacteristicId string `json:"targetCharacteristicId,omitempty"`
 }
 
 type Pipeline struct {
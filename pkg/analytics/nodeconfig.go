@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	CellConfigTypeInt    = "int"
+	CellConfigTypeFloat  = "float"
+	CellConfigTypeBool   = "bool"
+	CellConfigTypeString = "string"
+	CellConfigTypeJson   = "json"
+)
+
+type NodeConfigWarning struct {
+	NodeId string `json:"node_id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// coerceNodeConfigValue converts value to the string representation expected by the flow engine for the given cell config type
+// on error the uncoerced string representation of value is returned alongside the error
+// unknown types are passed through without validation
+func coerceNodeConfigValue(value interface{}, configType string) (result string, err error) {
+	raw, err := nodeConfigValueToString(value)
+	if err != nil {
+		return "", err
+	}
+	switch strings.ToLower(configType) {
+	case CellConfigTypeInt, "integer":
+		switch v := value.(type) {
+		case float64:
+			if v != math.Trunc(v) {
+				return raw, fmt.Errorf("expected int, got %v", raw)
+			}
+			return strconv.FormatInt(int64(v), 10), nil
+		default:
+			temp, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				return raw, fmt.Errorf("expected int, got %v", raw)
+			}
+			return strconv.FormatInt(temp, 10), nil
+		}
+	case CellConfigTypeFloat, "number":
+		temp, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return raw, fmt.Errorf("expected float, got %v", raw)
+		}
+		return strconv.FormatFloat(temp, 'f', -1, 64), nil
+	case CellConfigTypeBool, "boolean":
+		temp, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return raw, fmt.Errorf("expected bool, got %v", raw)
+		}
+		return strconv.FormatBool(temp), nil
+	case CellConfigTypeJson:
+		if !json.Valid([]byte(raw)) {
+			return raw, fmt.Errorf("expected json, got %v", raw)
+		}
+		return raw, nil
+	default:
+		return raw, nil
+	}
+}
+
+func nodeConfigValueToString(value interface{}) (string, error) {
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	temp, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("unable to interpret pipeline input config value %v: %w", value, err)
+	}
+	return string(temp), nil
+}
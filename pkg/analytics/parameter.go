@@ -22,229 +22,349 @@ import (
 	"fmt"
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
-	"strconv"
+	"slices"
 	"strings"
 )
 
 func (this *Analytics) getModuleData(task model.CamundaExternalTask) (result map[string]interface{}) {
 	result = map[string]interface{}{}
-	variable, ok := task.Variables[this.config.WorkerParamPrefix+"module_data"]
-	if !ok {
-		return result
-	}
-	str, ok := variable.Value.(string)
-	if !ok {
-		return result
-	}
-	err := json.Unmarshal([]byte(str), &result)
-	if err != nil {
+	found, err := this.getVariable(task, this.config.WorkerParamPrefix+"module_data", &result)
+	if !found || err != nil || result == nil {
 		return map[string]interface{}{}
 	}
 	return result
 }
 
 func (this *Analytics) getPipelineName(task model.CamundaExternalTask) string {
-	variable, ok := task.Variables[this.config.WorkerParamPrefix+"name"]
-	if !ok {
-		return ""
-	}
-	result, ok := variable.Value.(string)
-	if !ok {
-		return ""
-	}
-	return result
+	return this.getStringVariable(task, this.config.WorkerParamPrefix+"name")
 }
 
 func (this *Analytics) getConsumeAllMessages(task model.CamundaExternalTask) (result bool) {
-	variable, ok := task.Variables[this.config.WorkerParamPrefix+"consume_all_messages"]
-	if !ok {
-		return false
-	}
-	switch v := variable.Value.(type) {
-	case string:
-		err := json.Unmarshal([]byte(v), &result)
-		if err != nil {
-			return false
-		}
-		return result
-	case bool:
-		return v
-	default:
-		return false
+	return this.getBoolVariable(task, this.config.WorkerParamPrefix+"consume_all_messages", false)
+}
+
+// getDryRun returns an error if dry_run is set but not interpretable as bool
+// callers must not deploy in this case
+func (this *Analytics) getDryRun(task model.CamundaExternalTask) (result bool, err error) {
+	variableName := this.config.WorkerParamPrefix + "dry_run"
+	_, err = this.getVariable(task, variableName, &result)
+	if err != nil {
+		return false, fmt.Errorf("unable to interpret %v as bool: %w", variableName, err)
 	}
+	return result, nil
 }
 
 func (this *Analytics) getPipelineWindowTime(task model.CamundaExternalTask) (int, error) {
-	variable, ok := task.Variables[this.config.WorkerParamPrefix+"window_time"]
+	return this.getWindowTimeVariable(task, this.config.WorkerParamPrefix+"window_time")
+}
+
+func (this *Analytics) getWindowTimeVariable(task model.CamundaExternalTask, variableName string) (int, error) {
+	variable, ok := task.Variables[variableName]
 	if !ok {
 		return 0, nil
 	}
-	switch value := variable.Value.(type) {
-	case string:
-		temp, err := strconv.Atoi(value)
-		if err != nil {
-			return 0, err
-		}
-		return temp, nil
-	case float64:
-		return int(value), nil
-	case int:
-		return int(value), nil
-	case int64:
-		return int(value), nil
-	default:
-		return 0, errors.New("unknown type for window_time")
+	value, found, err := variableValue(variable)
+	if err != nil {
+		return 0, fmt.Errorf("unable to interpret %v: %w", variableName, err)
+	}
+	if !found {
+		return 0, nil
+	}
+	maxWindowTime, err := this.config.GetMaxWindowTime()
+	if err != nil {
+		return 0, err
+	}
+	result, err := parseWindowTime(value, maxWindowTime)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v: %w", variableName, err)
 	}
+	return result, nil
 }
 
 func (this *Analytics) getPipelineMergeStrategy(task model.CamundaExternalTask) (string, error) {
-	variable, ok := task.Variables[this.config.WorkerParamPrefix+"merge_strategy"]
-	if !ok {
-		return "inner", nil
+	result, err := this.getMergeStrategyVariable(task, this.config.WorkerParamPrefix+"merge_strategy")
+	if err != nil {
+		return DefaultMergeStrategy, err
 	}
-	value, ok := variable.Value.(string)
-	if !ok {
-		return "inner", errors.New("expected string for merge_strategy")
+	if result == "" {
+		return DefaultMergeStrategy, nil
+	}
+	return result, nil
+}
+
+// getNodeMergeStrategy returns "" if no node specific merge strategy is set
+func (this *Analytics) getNodeMergeStrategy(task model.CamundaExternalTask, inputId string) (string, error) {
+	return this.getMergeStrategyVariable(task, this.config.WorkerParamPrefix+"merge_strategy."+inputId)
+}
+
+func (this *Analytics) getMergeStrategyVariable(task model.CamundaExternalTask, variableName string) (string, error) {
+	var value string
+	_, err := this.getVariable(task, variableName, &value)
+	if err != nil {
+		return "", fmt.Errorf("unable to interpret %v: %w", variableName, err)
 	}
 	if value == "" {
-		return "inner", nil
+		return "", nil
+	}
+	if !slices.Contains(this.config.GetMergeStrategies(), value) {
+		return "", fmt.Errorf("unknown merge strategy in %v: %v (supported: %v)", variableName, value, strings.Join(this.config.GetMergeStrategies(), ", "))
 	}
 	return value, nil
 }
 
-func (this *Analytics) getPipelineDescription(task model.CamundaExternalTask) string {
-	variable, ok := task.Variables[this.config.WorkerParamPrefix+"desc"]
+// getNodeWindowTime returns nil if no node specific window time is set (missing, null or empty string)
+func (this *Analytics) getNodeWindowTime(task model.CamundaExternalTask, inputId string) (*int, error) {
+	variableName := this.config.WorkerParamPrefix + "window_time." + inputId
+	variable, ok := task.Variables[variableName]
 	if !ok {
-		return ""
+		return nil, nil
 	}
-	result, ok := variable.Value.(string)
-	if !ok {
-		return ""
+	value, found, err := variableValue(variable)
+	if err != nil {
+		return nil, fmt.Errorf("unable to interpret %v: %w", variableName, err)
 	}
-	return result
+	if str, isStr := value.(string); !found || (isStr && strings.TrimSpace(str) == "") {
+		return nil, nil
+	}
+	result, err := this.getWindowTimeVariable(task, variableName)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (this *Analytics) getPipelineDescription(task model.CamundaExternalTask) string {
+	return this.getStringVariable(task, this.config.WorkerParamPrefix+"desc")
 }
 
 func (this *Analytics) getFlowId(task model.CamundaExternalTask) string {
-	variable, ok := task.Variables[this.config.WorkerParamPrefix+"flow_id"]
-	if !ok {
-		return ""
-	}
-	result, ok := variable.Value.(string)
-	if !ok {
-		return ""
-	}
-	return result
+	return this.getStringVariable(task, this.config.WorkerParamPrefix+"flow_id")
 }
 
 func (this *Analytics) getPersistData(task model.CamundaExternalTask, inputId string) (result bool) {
-	variable, ok := task.Variables[this.config.WorkerParamPrefix+"persistData."+inputId]
-	if !ok {
-		return false
-	}
-	str, ok := variable.Value.(string)
+	return this.getBoolVariable(task, this.config.WorkerParamPrefix+"persistData."+inputId, false)
+}
+
+// getPipelineNodeConfig returns the config value coerced to conf.Type
+// on error the uncoerced value (or "" if the config is missing) is returned alongside the error, to be used in lenient mode
+func (this *Analytics) getPipelineNodeConfig(task model.CamundaExternalTask, inputId string, conf CellConfig) (string, error) {
+	key := this.config.WorkerParamPrefix + "conf." + inputId + "." + conf.Name
+	variable, ok := task.Variables[key]
 	if !ok {
-		return false
+		return "", errors.New("missing pipeline input config (" + key + ")")
 	}
-	err := json.Unmarshal([]byte(str), &result)
+	value, found, err := variableValue(variable)
 	if err != nil {
-		return false
+		return "", fmt.Errorf("unable to interpret pipeline input config %v: %w", key, err)
+	}
+	if !found {
+		return "", errors.New("missing pipeline input config (" + key + " is null)")
+	}
+	if m, ok := value.(map[string]interface{}); ok {
+		_, hasValue := m["value"]
+		_, isNative := variable.Value.(map[string]interface{})
+		switch {
+		case hasValue || (isNative && strings.ToLower(variable.Type) != "json"):
+			//legacy {"value": ...} wrapper
+			temp, err := json.Marshal(m["value"])
+			if err != nil {
+				return "", fmt.Errorf("unable to interpret pipeline input config %v (%v) \n%w", key, m, err)
+			}
+			value = string(temp)
+		default:
+			//json object config (e.g. a Json typed variable); passed through unchanged
+			if raw, isStr := variable.Value.(string); isStr {
+				value = raw
+			}
+		}
 	}
-	return result
+	return coerceNodeConfigValue(value, conf.Type)
 }
 
-func (this *Analytics) getPipelineNodeConfig(task model.CamundaExternalTask, inputId string, confName string) (string, error) {
-	key := this.config.WorkerParamPrefix + "conf." + inputId + "." + confName
-	variable, ok := task.Variables[key]
-	if !ok {
-		return "", nil //errors.New("missing pipeline input config (" + this.config.WorkerParamPrefix + "conf." + inputId + "." + confName + ")")
-	}
-	if strings.ToLower(variable.Type) == "null" {
-		return "", nil
+func (this *Analytics) getReconcile(task model.CamundaExternalTask) (result bool) {
+	return this.getBoolVariable(task, this.config.WorkerParamPrefix+"reconcile", true)
+}
+
+const (
+	EmptySelectionPolicyFail     = "fail"
+	EmptySelectionPolicyWarn     = "warn"
+	EmptySelectionPolicySkipNode = "skip-node"
+)
+
+var EmptySelectionPolicies = []string{EmptySelectionPolicyFail, EmptySelectionPolicyWarn, EmptySelectionPolicySkipNode}
+
+// getEmptySelectionPolicy decides how ports are handled, whose selections resolve to no input
+// defaults to EmptySelectionPolicyWarn
+func (this *Analytics) getEmptySelectionPolicy(task model.CamundaExternalTask) (string, error) {
+	variableName := this.config.WorkerParamPrefix + "empty_selection_policy"
+	result := strings.TrimSpace(this.getStringVariable(task, variableName))
+	if result == "" {
+		return EmptySelectionPolicyWarn, nil
 	}
-	if variable.Value == nil {
-		return "", nil
+	if !slices.Contains(EmptySelectionPolicies, result) {
+		return EmptySelectionPolicyWarn, fmt.Errorf("unknown empty selection policy in %v: %v (supported: %v)", variableName, result, strings.Join(EmptySelectionPolicies, ", "))
 	}
-	switch v := variable.Value.(type) {
-	case string:
-		return v, nil
-	case map[string]interface{}:
-		temp, err := json.Marshal(v["value"])
-		if err != nil {
-			return "", fmt.Errorf("unable to interpret pipeline input config %v (%v) \n%w", key, v, err)
-		}
-		return string(temp), err
-	default:
-		temp, err := json.Marshal(variable.Value)
-		if err != nil {
-			return "", fmt.Errorf("unable to interpret pipeline input config %v (%v) \n%w", key, v, err)
-		}
-		return string(temp), err
+	return result, nil
+}
+
+const (
+	RequestOnlyPolicyFail = "fail"
+	RequestOnlyPolicyWarn = "warn"
+)
+
+var RequestOnlyPolicies = []string{RequestOnlyPolicyFail, RequestOnlyPolicyWarn}
+
+// getRequestOnlyPolicy decides how selected devices are handled, whose services matching the criteria only support requests
+// these devices can not be used in pipelines and are always excluded (ExcludedReasonNoEventService)
+// defaults to RequestOnlyPolicyWarn
+func (this *Analytics) getRequestOnlyPolicy(task model.CamundaExternalTask) (string, error) {
+	variableName := this.config.WorkerParamPrefix + "request_only_policy"
+	result := strings.TrimSpace(this.getStringVariable(task, variableName))
+	if result == "" {
+		return RequestOnlyPolicyWarn, nil
+	}
+	if !slices.Contains(RequestOnlyPolicies, result) {
+		return RequestOnlyPolicyWarn, fmt.Errorf("unknown request only policy in %v: %v (supported: %v)", variableName, result, strings.Join(RequestOnlyPolicies, ", "))
 	}
+	return result, nil
 }
 
-func (this *Analytics) getSelection(task model.CamundaExternalTask, inputId string, portName string) (result model.IotOption, err error) {
-	variableName := this.config.WorkerParamPrefix + "selection." + inputId + "." + portName
-	variable, ok := task.Variables[variableName]
-	if !ok {
+func (this *Analytics) getStrictNodeConfig(task model.CamundaExternalTask) (result bool) {
+	return this.getBoolVariable(task, this.config.WorkerParamPrefix+"strict_node_config", this.config.StrictNodeConfig)
+}
+
+// getInputVariableName returns the name of the input specific variable ({{prefix}}{{kind}}.{{inputId}}.{{portName}}) if it is set
+// otherwise the name of the wildcard variable ({{prefix}}{{kind}}.*.{{portName}}) if it is set
+// if neither is set, the input specific name is returned
+// null values and empty strings count as unset (see isVariableSet)
+func (this *Analytics) getInputVariableName(task model.CamundaExternalTask, kind string, inputId string, portName string) string {
+	specific := this.config.WorkerParamPrefix + kind + "." + inputId + "." + portName
+	if isVariableSet(task, specific) {
+		return specific
+	}
+	wildcard := this.config.WorkerParamPrefix + kind + ".*." + portName
+	if isVariableSet(task, wildcard) {
+		return wildcard
+	}
+	return specific
+}
+
+// getSelections accepts a single model.IotOption or a list of model.IotOption
+func (this *Analytics) getSelections(task model.CamundaExternalTask, inputId string, portName string) (result []model.IotOption, err error) {
+	variableName := this.getInputVariableName(task, "selection", inputId, portName)
+	var raw json.RawMessage
+	found, err := this.getVariable(task, variableName, &raw)
+	if err != nil {
+		return result, fmt.Errorf("unable to interpret pipeline input selection (%v): %w", variableName, err)
+	}
+	if !found {
 		return result, errors.New("missing pipeline input selection (" + variableName + ")")
 	}
-	selectionStr, ok := variable.Value.(string)
-	if !ok {
-		return result, errors.New("unable to interpret pipeline input selection (" + variableName + ")")
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		err = json.Unmarshal(raw, &result)
+	} else {
+		var selection model.IotOption
+		err = json.Unmarshal(raw, &selection)
+		result = []model.IotOption{selection}
 	}
-	err = json.Unmarshal([]byte(selectionStr), &result)
 	if err != nil {
-		return result, fmt.Errorf("unable to interpret pipeline input selection (%v): %w", variableName, err)
+		return nil, fmt.Errorf("unable to interpret pipeline input selection (%v): %w", variableName, err)
 	}
 	return result, nil
 }
 
-func (this *Analytics) getNodePathCriteria(task model.CamundaExternalTask, inputId string, portName string) (result []devices.FilterCriteria, err error) {
-	variableName := this.config.WorkerParamPrefix + "criteria." + inputId + "." + portName
-	variable, ok := task.Variables[variableName]
+// CriteriaOnlySelection may be used as Input-IoT-Selection to select all devices of the user with an event service matching the criteria
+const CriteriaOnlySelection = "all_matching_devices"
+
+// isCriteriaOnlySelection returns true if the selection of the port is CriteriaOnlySelection
+// a missing selection never enables this mode, so that a forgotten selection (e.g. next to wildcard criteria) is still reported
+func (this *Analytics) isCriteriaOnlySelection(task model.CamundaExternalTask, inputId string, portName string) bool {
+	variable, ok := task.Variables[this.getInputVariableName(task, "selection", inputId, portName)]
 	if !ok {
-		return result, errors.New("missing pipeline input criteria (mandatory when selection is group or device without service) (" + variableName + ")")
+		return false
 	}
-	criteriaStr, ok := variable.Value.(string)
-	if !ok {
-		return result, errors.New("unable to interpret pipeline input criteria (" + variableName + ")")
+	value, found, _ := variableValue(variable)
+	if !found {
+		return false
 	}
-	err = json.Unmarshal([]byte(criteriaStr), &result)
+	str, ok := value.(string)
+	return ok && strings.Trim(strings.TrimSpace(str), "\"") == CriteriaOnlySelection
+}
+
+func (this *Analytics) getNodePathCriteria(task model.CamundaExternalTask, inputId string, portName string) (result []devices.FilterCriteria, err error) {
+	variableName := this.getInputVariableName(task, "criteria", inputId, portName)
+	found, err := this.getVariable(task, variableName, &result)
 	if err != nil {
 		return result, fmt.Errorf("unable to interpret pipeline input criteria (%v): %w", variableName, err)
 	}
-	return result, err
+	if !found {
+		return result, errors.New("missing pipeline input criteria (mandatory when selection is group, device without service or import without path) (" + variableName + ")")
+	}
+	err = checkCriteriaInteraction(variableName, result)
+	if err != nil {
+		return result, err
+	}
+	return result, nil
 }
 
 func (this *Analytics) getNodeServiceCriteria(task model.CamundaExternalTask, inputId string, portName string) (result []devices.FilterCriteria, err error) {
-	variableName := this.config.WorkerParamPrefix + "service_criteria." + inputId + "." + portName
-	variable, ok := task.Variables[variableName]
-	if !ok {
+	variableName := this.getInputVariableName(task, "service_criteria", inputId, portName)
+	found, err := this.getVariable(task, variableName, &result)
+	if err != nil {
+		return result, fmt.Errorf("unable to interpret pipeline input criteria (%v): %w", variableName, err)
+	}
+	if !found {
 		return nil, nil
 	}
-	criteriaStr, ok := variable.Value.(string)
-	if !ok {
-		return result, errors.New("unable to interpret pipeline input criteria (" + variableName + ")")
+	err = checkCriteriaInteraction(variableName, result)
+	if err != nil {
+		return result, err
 	}
-	if criteriaStr == "" {
-		return nil, nil
+	return result, nil
+}
+
+// checkCriteriaInteraction rejects criteria that can only match request services
+// pipelines consume events, so only devices.EVENT and devices.EVENT_AND_REQUEST are supported (empty defaults to devices.EVENT)
+func checkCriteriaInteraction(variableName string, criteria []devices.FilterCriteria) error {
+	for _, c := range criteria {
+		switch c.Interaction {
+		case "", devices.EVENT, devices.EVENT_AND_REQUEST:
+		case devices.REQUEST:
+			return fmt.Errorf("unsupported criteria interaction in %v: %v (pipelines consume events; supported: %v, %v)", variableName, c.Interaction, devices.EVENT, devices.EVENT_AND_REQUEST)
+		default:
+			return fmt.Errorf("unknown criteria interaction in %v: %v (supported: %v, %v)", variableName, c.Interaction, devices.EVENT, devices.EVENT_AND_REQUEST)
+		}
+	}
+	return nil
+}
+
+// getTargetCharacteristic returns "" if no target characteristic is set for the port
+func (this *Analytics) getTargetCharacteristic(task model.CamundaExternalTask, inputId string, portName string) (string, error) {
+	variableName := this.getInputVariableName(task, "target_characteristic", inputId, portName)
+	variable, ok := task.Variables[variableName]
+	if !ok {
+		return "", nil
 	}
-	err = json.Unmarshal([]byte(criteriaStr), &result)
+	value, found, err := variableValue(variable)
 	if err != nil {
-		return result, fmt.Errorf("unable to interpret pipeline input criteria (%v): %w", variableName, err)
+		return "", fmt.Errorf("unable to interpret %v: %w", variableName, err)
+	}
+	if !found {
+		return "", nil
+	}
+	result, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("expected characteristic id in %v, got %v", variableName, value)
 	}
-	return result, err
+	return strings.TrimSpace(result), nil
 }
 
 // if no key is set: return nil
 func (this *Analytics) getModuleKey(task model.CamundaExternalTask) (key *string) {
-	variable, ok := task.Variables[this.config.WorkerParamPrefix+"key"]
-	if !ok {
+	var result string
+	found, err := this.getVariable(task, this.config.WorkerParamPrefix+"key", &result)
+	if !found || err != nil {
 		return nil
 	}
-	result, ok := variable.Value.(string)
-	if ok {
-		return &result
-	}
-	return nil
+	return &result
 }
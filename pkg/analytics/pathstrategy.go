@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+const (
+	PathStrategyFirst               = "first"
+	PathStrategyAll                 = "all"
+	PathStrategyMatchCharacteristic = "match-characteristic"
+	PathStrategyMatchAspectExact    = "match-aspect-exact"
+	PathStrategyShortestPath        = "shortest-path"
+)
+
+var PathStrategies = []string{
+	PathStrategyFirst,
+	PathStrategyAll,
+	PathStrategyMatchCharacteristic,
+	PathStrategyMatchAspectExact,
+	PathStrategyShortestPath,
+}
+
+// pathStrategy decides which of the paths of a service found by criteria are used as node values
+type pathStrategy struct {
+	Name                   string
+	TargetCharacteristicId string
+	AspectIds              []string
+}
+
+// getPathStrategy reads the path strategy of a port
+// if none is set, config.EnableMultiplePaths decides between PathStrategyAll and PathStrategyFirst
+func (this *Analytics) getPathStrategy(task model.CamundaExternalTask, inputId string, portName string, criteria []devices.FilterCriteria) (result pathStrategy, err error) {
+	variableName := this.getInputVariableName(task, "path_strategy", inputId, portName)
+	result.Name = strings.TrimSpace(this.getStringVariable(task, variableName))
+	if result.Name == "" {
+		if this.config.EnableMultiplePaths {
+			result.Name = PathStrategyAll
+		} else {
+			result.Name = PathStrategyFirst
+		}
+		return result, nil
+	}
+	switch result.Name {
+	case PathStrategyFirst, PathStrategyAll, PathStrategyShortestPath:
+		return result, nil
+	case PathStrategyMatchCharacteristic:
+		result.TargetCharacteristicId, err = this.getTargetCharacteristic(task, inputId, portName)
+		if err != nil {
+			return result, err
+		}
+		if result.TargetCharacteristicId == "" {
+			return result, fmt.Errorf("path strategy %v in %v needs a target characteristic (%v)", result.Name, variableName, this.getInputVariableName(task, "target_characteristic", inputId, portName))
+		}
+		return result, nil
+	case PathStrategyMatchAspectExact:
+		for _, c := range criteria {
+			if c.AspectId != "" && !slices.Contains(result.AspectIds, c.AspectId) {
+				result.AspectIds = append(result.AspectIds, c.AspectId)
+			}
+		}
+		if len(result.AspectIds) == 0 {
+			return result, fmt.Errorf("path strategy %v in %v needs criteria with aspect_id", result.Name, variableName)
+		}
+		return result, nil
+	default:
+		return result, fmt.Errorf("unknown path strategy in %v: %v (supported: %v)", variableName, result.Name, strings.Join(PathStrategies, ", "))
+	}
+}
+
+// apply returns the paths selected by the strategy, in the order of the input
+// the result may be empty if no path matches
+func (this pathStrategy) apply(paths []servicePath) (result []servicePath, err error) {
+	if len(paths) == 0 {
+		return paths, nil
+	}
+	switch this.Name {
+	case PathStrategyFirst, "":
+		return paths[:1], nil
+	case PathStrategyAll:
+		return paths, nil
+	case PathStrategyMatchCharacteristic:
+		for _, path := range paths {
+			if path.CharacteristicId == this.TargetCharacteristicId {
+				result = append(result, path)
+			}
+		}
+		return result, nil
+	case PathStrategyMatchAspectExact:
+		for _, path := range paths {
+			if slices.Contains(this.AspectIds, path.AspectId) {
+				result = append(result, path)
+			}
+		}
+		return result, nil
+	case PathStrategyShortestPath:
+		shortest := paths[0]
+		for _, path := range paths[1:] {
+			if pathDepth(path.Path) < pathDepth(shortest.Path) {
+				shortest = path
+			}
+		}
+		return []servicePath{shortest}, nil
+	default:
+		return nil, errors.New("unknown path strategy: " + this.Name)
+	}
+}
+
+func pathDepth(path string) int {
+	return strings.Count(path, ".") + 1
+}
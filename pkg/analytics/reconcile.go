@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// ReconcileVariablesField is the module data field, in which keyed modules store the task variables
+// needed to re-resolve the pipeline request in Reconcile
+const ReconcileVariablesField = "reconcile_variables"
+
+type reconcileVariable struct {
+	Type  string      `json:"type,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// getReconcileVariables returns all worker variables and all process variables referenced by name or description templates
+func (this *Analytics) getReconcileVariables(task model.CamundaExternalTask) map[string]reconcileVariable {
+	result := map[string]reconcileVariable{}
+	excluded := map[string]bool{
+		this.config.WorkerParamPrefix + "module_data": true,
+		this.config.WorkerParamPrefix + "dry_run":     true,
+	}
+	for name, variable := range task.Variables {
+		if strings.HasPrefix(name, this.config.WorkerParamPrefix) && !excluded[name] {
+			result[name] = reconcileVariable{Type: variable.Type, Value: variable.Value}
+		}
+	}
+	for _, template := range []string{this.getPipelineName(task), this.getPipelineDescription(task)} {
+		for _, match := range templatePlaceholderRegex.FindAllStringSubmatch(template, -1) {
+			if name, ok := strings.CutPrefix(match[1], "var."); ok {
+				if variable, exists := task.Variables[name]; exists {
+					result[name] = reconcileVariable{Type: variable.Type, Value: variable.Value}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// Reconcile re-resolves the pipeline request of a keyed module (e.g. to follow changed device-group members)
+// and updates the pipeline if its hash differs from the pipeline_request_hash in the module data
+// the new hash is written back to the module data after a successful update
+// modules without stored variables or with {{prefix}}reconcile == false are ignored
+func (this *Analytics) Reconcile(ctx context.Context, token auth.Token, module model.SmartServiceModule) (updated bool, err error) {
+	stored, ok := module.ModuleData[ReconcileVariablesField]
+	if !ok || stored == nil {
+		return false, nil
+	}
+	temp, err := json.Marshal(stored)
+	if err != nil {
+		return false, err
+	}
+	variables := map[string]reconcileVariable{}
+	err = json.Unmarshal(temp, &variables)
+	if err != nil {
+		return false, err
+	}
+	task := model.CamundaExternalTask{
+		ProcessInstanceId: module.InstanceId,
+		Variables:         map[string]model.CamundaVariable{},
+	}
+	for name, variable := range variables {
+		task.Variables[name] = model.CamundaVariable{Type: variable.Type, Value: variable.Value}
+	}
+	if !this.getReconcile(task) {
+		return false, nil
+	}
+	pipelineId, ok := module.ModuleData["pipeline_id"].(string)
+	if !ok {
+		return false, errors.New("missing pipeline_id in module data")
+	}
+
+	pipelineRequest, err := this.getPipelineRequest(ctx, token, task, newTaskState(this.devices))
+	if err != nil {
+		return false, err
+	}
+	pipelineRequest.Id = pipelineId
+	hash, err := HashPipelineRequest(pipelineRequest)
+	if err != nil {
+		return false, err
+	}
+
+	if previousHash, _ := module.ModuleData[PipelineRequestHashField].(string); previousHash == hash {
+		return false, nil
+	}
+
+	_, err, _ = this.SendUpdateRequest(ctx, token, pipelineRequest)
+	if err != nil {
+		return false, err
+	}
+	this.libConfig.GetLogger().Info("reconciled pipeline", "moduleId", module.Id, "pipelineId", pipelineId, "hash", hash)
+
+	moduleData := maps.Clone(module.ModuleData)
+	moduleData[PipelineRequestHashField] = hash
+	moduleInit := module.SmartServiceModuleInit
+	moduleInit.ModuleData = moduleData
+	_, err = this.smartServiceRepo.SendWorkerModules([]model.Module{{
+		Id:                     module.Id,
+		ProcesInstanceId:       module.InstanceId,
+		SmartServiceModuleInit: moduleInit,
+	}})
+	return true, err
+}
+
+// AddReconcileInstance registers a process instance, whose keyed modules are reconciled by StartReconcileLoop
+// instances are registered by task executions and health checks and are forgotten once they have no modules left
+func (this *Analytics) AddReconcileInstance(processInstanceId string) {
+	if processInstanceId == "" {
+		return
+	}
+	this.reconcileMux.Lock()
+	defer this.reconcileMux.Unlock()
+	this.reconcileInstances[processInstanceId] = true
+}
+
+// StartReconcileLoop calls ReconcileAll every interval until ctx is done
+func (this *Analytics) StartReconcileLoop(ctx context.Context, interval time.Duration, query model.ModulQuery) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				this.ReconcileAll(query)
+			}
+		}
+	}()
+}
+
+// ReconcileAll reconciles the modules of all registered process instances (see AddReconcileInstance and Reconcile)
+// errors are logged
+func (this *Analytics) ReconcileAll(query model.ModulQuery) {
+	this.reconcileMux.Lock()
+	instances := make([]string, 0, len(this.reconcileInstances))
+	for instanceId := range this.reconcileInstances {
+		instances = append(instances, instanceId)
+	}
+	this.reconcileMux.Unlock()
+
+	for _, instanceId := range instances {
+		modules, err := this.smartServiceRepo.ListExistingModules(instanceId, query)
+		if err != nil {
+			this.libConfig.GetLogger().Error("unable to list modules for reconciliation", "processInstanceId", instanceId, "error", err)
+			continue
+		}
+		if len(modules) == 0 {
+			this.reconcileMux.Lock()
+			delete(this.reconcileInstances, instanceId)
+			this.reconcileMux.Unlock()
+			continue
+		}
+		for _, module := range modules {
+			this.reconcileModule(module)
+		}
+	}
+}
+
+func (this *Analytics) reconcileModule(module model.SmartServiceModule) {
+	token, err := this.auth.ExchangeUserToken(module.UserId)
+	if err != nil {
+		this.libConfig.GetLogger().Error("unable to exchange user token for reconciliation", "moduleId", module.Id, "error", err)
+		return
+	}
+	ctx, cancel := this.newTaskContext()
+	defer cancel()
+	_, err = this.Reconcile(ctx, token, module)
+	if err != nil {
+		this.libConfig.GetLogger().Error("unable to reconcile pipeline", "moduleId", module.Id, "error", err)
+	}
+}
@@ -18,30 +18,53 @@ package analytics
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"runtime/debug"
-	"time"
 
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
 )
 
-var DefaultTimeout = 30 * time.Second
+// the flow engine rejects invalid pipeline requests with 400 or 422
+var invalidPipelineStatusKinds = map[int]error{
+	http.StatusBadRequest:          ErrInvalidPipeline,
+	http.StatusUnprocessableEntity: ErrInvalidPipeline,
+}
+
+var flowNotFoundStatusKinds = map[int]error{
+	http.StatusNotFound: ErrFlowNotFound,
+}
+
+// withoutAmbiguousDeployKind removes ErrUpstreamUnavailable unless the flow engine certainly did not create the pipeline
+// only failed connections and 4xx responses (429) are definitive; 5xx responses and errors after the connection
+// was established (e.g. timeouts, dropped connections) may follow a deployment, a retry could deploy a duplicate
+func withoutAmbiguousDeployKind(err *UpstreamError) *UpstreamError {
+	if err.Kind != ErrUpstreamUnavailable {
+		return err
+	}
+	var opErr *net.OpError
+	connectionFailed := err.StatusCode == 0 && errors.As(err.Cause, &opErr) && opErr.Op == "dial"
+	definitiveResponse := err.StatusCode >= 400 && err.StatusCode < 500
+	if !connectionFailed && !definitiveResponse {
+		err.Kind = nil
+	}
+	return err
+}
 
-func (this *Analytics) SendDeployRequest(token auth.Token, request PipelineRequest) (result Pipeline, err error, code int) {
+func (this *Analytics) SendDeployRequest(ctx context.Context, token auth.Token, request PipelineRequest) (result Pipeline, err error, code int) {
 	body, err := json.Marshal(request)
 	if err != nil {
 		return result, err, http.StatusInternalServerError
 	}
 	this.libConfig.GetLogger().Debug("deploy event pipeline", "request", string(body))
-	client := http.Client{
-		Timeout: DefaultTimeout,
-	}
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"POST",
 		this.config.FlowEngineUrl+"/pipeline",
 		bytes.NewBuffer(body),
@@ -53,15 +76,16 @@ func (this *Analytics) SendDeployRequest(token auth.Token, request PipelineReque
 	req.Header.Set("Authorization", token.Jwt())
 	req.Header.Set("X-UserId", token.GetUserId())
 	this.libConfig.GetLogger().Debug("send analytics deployment with token", "token", req.Header.Get("Authorization"))
-	resp, err := client.Do(req)
+	resp, err := this.flowEngine.Do(req)
 	if err != nil {
+		err = withoutAmbiguousDeployKind(newUpstreamRequestError(ctx, UpstreamFlowEngine, err))
 		this.libConfig.GetLogger().Error("error in SendDeployRequest", "error", err, "stack", string(debug.Stack()))
 		return result, err, http.StatusInternalServerError
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		err = errors.New("unexpected statuscode")
+		err = withoutAmbiguousDeployKind(newUpstreamResponseError(UpstreamFlowEngine, resp, invalidPipelineStatusKinds))
 		this.libConfig.GetLogger().Error("error in SendDeployRequest", "error", err, "stack", string(debug.Stack()), "statuscode", resp.StatusCode)
 		return result, err, resp.StatusCode
 	}
@@ -70,16 +94,14 @@ func (this *Analytics) SendDeployRequest(token auth.Token, request PipelineReque
 	return result, err, http.StatusOK
 }
 
-func (this *Analytics) SendUpdateRequest(token auth.Token, request PipelineRequest) (result Pipeline, err error, code int) {
+func (this *Analytics) SendUpdateRequest(ctx context.Context, token auth.Token, request PipelineRequest) (result Pipeline, err error, code int) {
 	body, err := json.Marshal(request)
 	if err != nil {
 		return result, err, http.StatusInternalServerError
 	}
 	this.libConfig.GetLogger().Debug("deploy event pipeline", "request", string(body))
-	client := http.Client{
-		Timeout: DefaultTimeout,
-	}
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"PUT",
 		this.config.FlowEngineUrl+"/pipeline",
 		bytes.NewBuffer(body),
@@ -91,16 +113,17 @@ func (this *Analytics) SendUpdateRequest(token auth.Token, request PipelineReque
 	req.Header.Set("Authorization", token.Jwt())
 	req.Header.Set("X-UserId", token.GetUserId())
 	this.libConfig.GetLogger().Debug("send analytics deployment update with token", "token", req.Header.Get("Authorization"))
-	resp, err := client.Do(req)
+	resp, err := this.flowEngine.Do(req)
 	if err != nil {
-		this.libConfig.GetLogger().Error("error in SendDeployRequest", "error", err, "stack", string(debug.Stack()))
+		err = newUpstreamRequestError(ctx, UpstreamFlowEngine, err)
+		this.libConfig.GetLogger().Error("error in SendUpdateRequest", "error", err, "stack", string(debug.Stack()))
 		return result, err, http.StatusInternalServerError
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		err = errors.New("unexpected statuscode")
-		this.libConfig.GetLogger().Error("error in SendDeployRequest", "error", err, "stack", string(debug.Stack()), "statuscode", resp.StatusCode)
+		err = newUpstreamResponseError(UpstreamFlowEngine, resp, invalidPipelineStatusKinds)
+		this.libConfig.GetLogger().Error("error in SendUpdateRequest", "error", err, "stack", string(debug.Stack()), "statuscode", resp.StatusCode)
 		return result, err, resp.StatusCode
 	}
 
@@ -108,11 +131,9 @@ func (this *Analytics) SendUpdateRequest(token auth.Token, request PipelineReque
 	return result, err, http.StatusOK
 }
 
-func (this *Analytics) Remove(token auth.Token, pipelineId string) error {
-	client := http.Client{
-		Timeout: DefaultTimeout,
-	}
-	req, err := http.NewRequest(
+func (this *Analytics) Remove(ctx context.Context, token auth.Token, pipelineId string) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"DELETE",
 		this.config.FlowEngineUrl+"/pipeline/"+url.PathEscape(pipelineId),
 		nil,
@@ -123,14 +144,15 @@ func (this *Analytics) Remove(token auth.Token, pipelineId string) error {
 	}
 	req.Header.Set("Authorization", token.Jwt())
 	req.Header.Set("X-UserId", token.GetUserId())
-	resp, err := client.Do(req)
+	resp, err := this.flowEngine.Do(req)
 	if err != nil {
+		err = newUpstreamRequestError(ctx, UpstreamFlowEngine, err)
 		this.libConfig.GetLogger().Error("error in Remove", "error", err, "stack", string(debug.Stack()))
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		err = errors.New("unexpected statuscode")
+		err = newUpstreamResponseError(UpstreamFlowEngine, resp, nil)
 		this.libConfig.GetLogger().Error("error in Remove", "error", err, "stack", string(debug.Stack()), "statuscode", resp.StatusCode)
 		return err
 	}
@@ -144,11 +166,9 @@ type PipelineState struct {
 	Transitioning bool   `json:"transitioning"`
 }
 
-func (this *Analytics) CheckPipeline(token auth.Token, pipelineId string) (state PipelineState, code int, err error) {
-	client := http.Client{
-		Timeout: DefaultTimeout,
-	}
-	req, err := http.NewRequest(
+func (this *Analytics) CheckPipeline(ctx context.Context, token auth.Token, pipelineId string) (state PipelineState, code int, err error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"GET",
 		this.config.FlowEngineUrl+"/pipeline/"+url.PathEscape(pipelineId),
 		nil,
@@ -162,15 +182,15 @@ func (this *Analytics) CheckPipeline(token auth.Token, pipelineId string) (state
 
 	this.libConfig.GetLogger().Debug("check pipeline request", "url", req.URL.String(), "method", req.Method, "token", req.Header.Get("Authorization"), "xuser", req.Header.Get("X-UserId"))
 
-	resp, err := client.Do(req)
+	resp, err := this.flowEngine.Do(req)
 	if err != nil {
+		err = newUpstreamRequestError(ctx, UpstreamFlowEngine, err)
 		this.libConfig.GetLogger().Error("error in CheckPipeline", "error", err, "stack", string(debug.Stack()))
 		return state, 0, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		pl, _ := io.ReadAll(resp.Body)
-		err = fmt.Errorf("unexpected statuscode while checking pipeline %v: %v, %v", pipelineId, resp.StatusCode, string(pl))
+		err = fmt.Errorf("unable to check pipeline %v: %w", pipelineId, newUpstreamResponseError(UpstreamFlowEngine, resp, nil))
 		return state, resp.StatusCode, err
 	}
 	err = json.NewDecoder(resp.Body).Decode(&state)
@@ -180,11 +200,9 @@ func (this *Analytics) CheckPipeline(token auth.Token, pipelineId string) (state
 	return state, resp.StatusCode, nil
 }
 
-func (this *Analytics) GetFlowInputs(token auth.Token, id string) (result []FlowModelCell, err error, code int) {
-	client := http.Client{
-		Timeout: DefaultTimeout,
-	}
-	req, err := http.NewRequest(
+func (this *Analytics) GetFlowInputs(ctx context.Context, token auth.Token, id string) (result []FlowModelCell, err error, code int) {
+	req, err := http.NewRequestWithContext(
+		ctx,
 		"GET",
 		this.config.FlowParserUrl+"/flow/getinputs/"+url.PathEscape(id),
 		nil,
@@ -195,15 +213,16 @@ func (this *Analytics) GetFlowInputs(token auth.Token, id string) (result []Flow
 	}
 	req.Header.Set("Authorization", token.Jwt())
 	req.Header.Set("X-UserId", token.GetUserId())
-	resp, err := client.Do(req)
+	resp, err := this.flowParser.Do(req)
 	if err != nil {
+		err = newUpstreamRequestError(ctx, UpstreamFlowParser, err)
 		this.libConfig.GetLogger().Error("error in GetFlowInputs", "error", err, "stack", string(debug.Stack()))
 		return result, err, http.StatusInternalServerError
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		err = errors.New("unexpected statuscode")
+		err = newUpstreamResponseError(UpstreamFlowParser, resp, flowNotFoundStatusKinds)
 		this.libConfig.GetLogger().Error("error in GetFlowInputs", "error", err, "stack", string(debug.Stack()), "statuscode", resp.StatusCode)
 		return result, err, resp.StatusCode
 	}
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+)
+
+func TestSendDeployRequestErrors(t *testing.T) {
+	refused := httptest.NewServer(respondWithStatus(http.StatusOK))
+	refused.Close()
+
+	for _, tc := range []struct {
+		name      string
+		handler   http.HandlerFunc
+		transient bool
+		kind      error
+	}{
+		{name: "gateway timeout is ambiguous", handler: respondWithStatus(http.StatusGatewayTimeout), transient: false},
+		{name: "closed connection is ambiguous", handler: closeConnection, transient: false},
+		{name: "timeout is ambiguous", handler: func(writer http.ResponseWriter, request *http.Request) {
+			time.Sleep(400 * time.Millisecond)
+		}, transient: false},
+		{name: "service unavailable is ambiguous", handler: respondWithStatus(http.StatusServiceUnavailable), transient: false},
+		{name: "bad gateway is ambiguous", handler: respondWithStatus(http.StatusBadGateway), transient: false},
+		{name: "internal server error", handler: respondWithStatus(http.StatusInternalServerError), transient: false},
+		{name: "too many requests", handler: respondWithStatus(http.StatusTooManyRequests), transient: true},
+		{name: "invalid pipeline", handler: respondWithStatus(http.StatusBadRequest), transient: false, kind: ErrInvalidPipeline},
+		{name: "forbidden", handler: respondWithStatus(http.StatusForbidden), transient: false, kind: ErrForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, requests := newFlowEngineMock(t, tc.handler)
+			handler := newTestAnalytics(t, Config{FlowEngineUrl: server.URL}, newTestFlowEngineClient())
+			_, err, _ := handler.SendDeployRequest(context.Background(), auth.Token{}, PipelineRequest{})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if IsTransientError(err) != tc.transient {
+				t.Error("unexpected transient classification", err)
+			}
+			if tc.kind != nil && !errors.Is(err, tc.kind) {
+				t.Error("unexpected kind", err)
+			}
+			var upstreamErr *UpstreamError
+			if !errors.As(err, &upstreamErr) || upstreamErr.Upstream != UpstreamFlowEngine {
+				t.Error("expected flow-engine UpstreamError", err)
+			}
+			//deploy requests are never repeated by the client, a retry could create a duplicate pipeline
+			if count := requests.Load(); count != 1 {
+				t.Error("unexpected number of deploy requests", count)
+			}
+		})
+	}
+
+	t.Run("connection refused", func(t *testing.T) {
+		handler := newTestAnalytics(t, Config{FlowEngineUrl: refused.URL}, newTestFlowEngineClient())
+		_, err, _ := handler.SendDeployRequest(context.Background(), auth.Token{}, PipelineRequest{})
+		if !IsTransientError(err) {
+			t.Error("a refused connection can not have created a pipeline and should be transient", err)
+		}
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		server, _ := newFlowEngineMock(t, respondWithStatus(http.StatusOK))
+		handler := newTestAnalytics(t, Config{FlowEngineUrl: server.URL}, newTestFlowEngineClient())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err, _ := handler.SendDeployRequest(ctx, auth.Token{}, PipelineRequest{})
+		if err == nil || IsTransientError(err) {
+			t.Error("expected non transient error", err)
+		}
+	})
+}
+
+func TestSendUpdateRequestRetriesGatewayTimeout(t *testing.T) {
+	server, requests := newFlowEngineMock(t, respondWithStatus(http.StatusGatewayTimeout))
+	handler := newTestAnalytics(t, Config{FlowEngineUrl: server.URL}, newTestFlowEngineClient())
+	_, err, _ := handler.SendUpdateRequest(context.Background(), auth.Token{}, PipelineRequest{})
+	//updates are idempotent: the client retries them and a gateway timeout stays transient
+	if !IsTransientError(err) {
+		t.Error("expected transient error", err)
+	}
+	if count := requests.Load(); count != 4 {
+		t.Error("unexpected number of update requests", count)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"encoding/json"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/imports"
+)
+
+// taskState collects entities resolved while a single task is handled
+type taskState struct {
+	devices         Devices //memoizes device repository requests of the task
+	deviceGroups    []devices.DeviceGroup
+	imports         []imports.Import
+	importInstances map[string]imports.Import //prefetched import instances by id
+	emptyPorts      []string
+	excludedDevices []ExcludedDevice
+}
+
+func newTaskState(repo Devices) *taskState {
+	return &taskState{devices: devices.NewCached(repo, 0, 0)}
+}
+
+func (this *taskState) addDeviceGroup(group devices.DeviceGroup) {
+	for _, existing := range this.deviceGroups {
+		if existing.Id == group.Id {
+			return
+		}
+	}
+	this.deviceGroups = append(this.deviceGroups, group)
+}
+
+// addEmptyPort records a port ({{inputId}}.{{portName}}) whose selections resolved to no input
+func (this *taskState) addEmptyPort(inputId string, portName string) {
+	this.emptyPorts = append(this.emptyPorts, inputId+"."+portName)
+}
+
+func (this *taskState) addExcludedDevices(excluded []ExcludedDevice) {
+	this.excludedDevices = append(this.excludedDevices, excluded...)
+}
+
+// getRequestOnlyDevices returns the excluded devices, whose services matching the criteria only support requests
+func (this *taskState) getRequestOnlyDevices() (result []ExcludedDevice) {
+	for _, device := range this.excludedDevices {
+		if device.Reason == ExcludedReasonNoEventService {
+			result = append(result, device)
+		}
+	}
+	return result
+}
+
+// addOutputs adds the task outputs derived from the state to outputs
+// empty_ports and excluded_devices are always set ("[]" if empty), so that process expressions may reference them
+func (this *taskState) addOutputs(outputs map[string]interface{}) error {
+	emptyPorts := this.emptyPorts
+	if emptyPorts == nil {
+		emptyPorts = []string{}
+	}
+	temp, err := json.Marshal(emptyPorts)
+	if err != nil {
+		return err
+	}
+	outputs["empty_ports"] = string(temp)
+
+	excludedDevices := this.excludedDevices
+	if excludedDevices == nil {
+		excludedDevices = []ExcludedDevice{}
+	}
+	temp, err = json.Marshal(excludedDevices)
+	if err != nil {
+		return err
+	}
+	outputs["excluded_devices"] = string(temp)
+	return nil
+}
+
+// addModuleData adds the module data derived from the state to moduleData
+// fields are only set if they are not empty
+func (this *taskState) addModuleData(moduleData map[string]interface{}) {
+	if len(this.excludedDevices) > 0 {
+		moduleData["excluded_devices"] = this.excludedDevices
+	} else {
+		delete(moduleData, "excluded_devices") //may be left by a previous version of a keyed module
+	}
+}
+
+func (this *taskState) addImport(importInstance imports.Import) {
+	for _, existing := range this.imports {
+		if existing.Id == importInstance.Id {
+			return
+		}
+	}
+	this.imports = append(this.imports, importInstance)
+}
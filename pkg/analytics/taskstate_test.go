@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+)
+
+func TestTaskStateMemoizesDeviceRequests(t *testing.T) {
+	repo := &countingDevices{calls: map[string]int{}}
+	ctx := context.Background()
+	token := auth.Token{}
+	criteria := []devices.FilterCriteria{{FunctionId: "f1"}}
+
+	state := newTaskState(repo)
+	for i := 0; i < 3; i++ {
+		state.devices.GetDeviceGroup(ctx, token, "g1")
+		state.devices.GetDeviceInfosOfDevices(ctx, token, []string{"d2", "d1"})
+		state.devices.GetDeviceInfosOfDevices(ctx, token, []string{"d1", "d2", "d1"}) //same ids in a different order
+		state.devices.GetDevicesOfDeviceTypes(ctx, token, []string{"dt1"})
+		state.devices.GetDeviceTypeSelectables(ctx, token, criteria, true, false)
+	}
+	state.devices.GetDeviceGroup(ctx, token, "g2")
+	state.devices.GetDeviceTypeSelectables(ctx, token, criteria, false, false)
+
+	expected := map[string]int{
+		"GetDeviceGroup":           2,
+		"GetDeviceInfosOfDevices":  1,
+		"GetDevicesOfDeviceTypes":  1,
+		"GetDeviceTypeSelectables": 2,
+	}
+	for method, count := range expected {
+		if repo.calls[method] != count {
+			t.Error("unexpected number of calls of", method, repo.calls[method], count)
+		}
+	}
+
+	//a new task does not reuse the results of the previous task
+	newTaskState(repo).devices.GetDeviceGroup(ctx, token, "g1")
+	if repo.calls["GetDeviceGroup"] != 3 {
+		t.Error("expected a new request for a new task state", repo.calls["GetDeviceGroup"])
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+var templatePlaceholderRegex = regexp.MustCompile(`{{\s*([^{}]*?)\s*}}`)
+
+// renderTemplate replaces placeholders in pipeline names and descriptions
+// supported placeholders:
+//   - {{var.<variable-name>}}: value of the process variable <variable-name>
+//   - {{group.name}}, {{group.names}}: name of the first / comma separated names of all selected device groups
+//   - {{import.name}}, {{import.names}}: name of the first / comma separated names of all selected imports
+//
+// placeholders that can not be resolved (e.g. unknown names, literal "{{...}}" text of existing process models) are left untouched and logged
+func (this *Analytics) renderTemplate(task model.CamundaExternalTask, state *taskState, template string) (result string) {
+	return templatePlaceholderRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := templatePlaceholderRegex.FindStringSubmatch(placeholder)[1]
+		value, err := this.resolveTemplatePlaceholder(task, state, name)
+		if err != nil {
+			this.libConfig.GetLogger().Warn("unable to render template placeholder, keep it unchanged", "processInstanceId", task.ProcessInstanceId, "placeholder", placeholder, "error", err)
+			return placeholder
+		}
+		return value
+	})
+}
+
+func (this *Analytics) resolveTemplatePlaceholder(task model.CamundaExternalTask, state *taskState, name string) (string, error) {
+	if variableName, ok := strings.CutPrefix(name, "var."); ok {
+		if _, exists := task.Variables[variableName]; !exists {
+			return "", fmt.Errorf("unknown process variable in template: %v", variableName)
+		}
+		return this.getStringVariable(task, variableName), nil
+	}
+	groupNames := []string{}
+	for _, group := range state.deviceGroups {
+		groupNames = append(groupNames, group.Name)
+	}
+	importNames := []string{}
+	for _, importInstance := range state.imports {
+		importNames = append(importNames, importInstance.Name)
+	}
+	switch name {
+	case "group.name":
+		return firstTemplateValue(groupNames, name)
+	case "group.names":
+		return strings.Join(groupNames, ", "), nil
+	case "import.name":
+		return firstTemplateValue(importNames, name)
+	case "import.names":
+		return strings.Join(importNames, ", "), nil
+	default:
+		return "", fmt.Errorf("unknown template placeholder: {{%v}}", name)
+	}
+}
+
+func firstTemplateValue(values []string, name string) (string, error) {
+	if len(values) == 0 {
+		return "", fmt.Errorf("template placeholder {{%v}} references nothing selected", name)
+	}
+	return values[0], nil
+}
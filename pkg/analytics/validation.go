@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+type ParameterError struct {
+	Variable string `json:"variable"`
+	Message  string `json:"message"`
+}
+
+// ParameterErrors collects all problems found in the task variables,
+// so that the user can fix them at once instead of one per process run
+type ParameterErrors []ParameterError
+
+func (this ParameterErrors) Error() string {
+	lines := []string{fmt.Sprintf("invalid analytics parameters (%v problems found):", len(this))}
+	for _, e := range this {
+		lines = append(lines, "- "+e.Variable+": "+e.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (this *ParameterErrors) add(variable string, err error) {
+	if err == nil {
+		return
+	}
+	*this = append(*this, ParameterError{Variable: variable, Message: err.Error()})
+}
+
+// validateParameters checks every task variable needed to build a pipeline request for the given flow inputs
+// returns nil or ParameterErrors
+func (this *Analytics) validateParameters(task model.CamundaExternalTask, inputs []FlowModelCell) error {
+	result := ParameterErrors{}
+	prefix := this.config.WorkerParamPrefix
+
+	_, err := this.getDryRun(task)
+	result.add(prefix+"dry_run", err)
+
+	if this.getPipelineName(task) == "" {
+		result.add(prefix+"name", fmt.Errorf("missing pipeline name"))
+	}
+	_, err = this.getPipelineWindowTime(task)
+	result.add(prefix+"window_time", err)
+
+	_, err = this.getEmptySelectionPolicy(task)
+	result.add(prefix+"empty_selection_policy", err)
+
+	_, err = this.getRequestOnlyPolicy(task)
+	result.add(prefix+"request_only_policy", err)
+
+	_, err = this.getPipelineMergeStrategy(task)
+	result.add(prefix+"merge_strategy", err)
+
+	strictNodeConfig := this.getStrictNodeConfig(task)
+	for _, input := range inputs {
+		_, err = this.getNodeWindowTime(task, input.Id)
+		result.add(prefix+"window_time."+input.Id, err)
+
+		_, err = this.getNodeMergeStrategy(task, input.Id)
+		result.add(prefix+"merge_strategy."+input.Id, err)
+
+		if strictNodeConfig {
+			for _, conf := range input.Config {
+				_, err = this.getPipelineNodeConfig(task, input.Id, conf)
+				result.add(prefix+"conf."+input.Id+"."+conf.Name, err)
+			}
+		}
+		for _, port := range input.InPorts {
+			_, err = this.getTargetCharacteristic(task, input.Id, port)
+			result.add(this.getInputVariableName(task, "target_characteristic", input.Id, port), err)
+
+			needsCriteria := this.isCriteriaOnlySelection(task, input.Id, port)
+			if !needsCriteria {
+				selections, err := this.getSelections(task, input.Id, port)
+				if err != nil {
+					result.add(this.getInputVariableName(task, "selection", input.Id, port), err)
+					continue
+				}
+				for _, selection := range selections {
+					if selection.DeviceGroupSelection != nil || (selection.DeviceSelection != nil && selection.DeviceSelection.ServiceId == nil) || (selection.ImportSelection != nil && selection.ImportSelection.Path == nil) {
+						needsCriteria = true
+					}
+				}
+			}
+			if !needsCriteria {
+				continue
+			}
+			criteria, err := this.getNodePathCriteria(task, input.Id, port)
+			result.add(this.getInputVariableName(task, "criteria", input.Id, port), err)
+
+			_, err = this.getPathStrategy(task, input.Id, port, criteria)
+			result.add(this.getInputVariableName(task, "path_strategy", input.Id, port), err)
+
+			_, err = this.getNodeServiceCriteria(task, input.Id, port)
+			result.add(this.getInputVariableName(task, "service_criteria", input.Id, port), err)
+		}
+	}
+
+	if len(result) > 0 {
+		return result
+	}
+	return nil
+}
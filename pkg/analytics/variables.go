@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package analytics
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// getVariable decodes the task variable with the given name into result
+// see decodeVariable
+func (this *Analytics) getVariable(task model.CamundaExternalTask, name string, result interface{}) (found bool, err error) {
+	variable, ok := task.Variables[name]
+	if !ok {
+		return false, nil
+	}
+	return decodeVariable(variable, result)
+}
+
+// getBoolVariable returns defaultValue if the variable is missing, null or not interpretable as bool
+func (this *Analytics) getBoolVariable(task model.CamundaExternalTask, name string, defaultValue bool) bool {
+	var result bool
+	found, err := this.getVariable(task, name, &result)
+	if !found || err != nil {
+		return defaultValue
+	}
+	return result
+}
+
+// getStringVariable returns "" if the variable is missing or null
+func (this *Analytics) getStringVariable(task model.CamundaExternalTask, name string) string {
+	var result string
+	found, err := this.getVariable(task, name, &result)
+	if !found || err != nil {
+		return ""
+	}
+	return result
+}
+
+// decodeVariable decodes the value of a camunda variable into result
+// accepted values:
+//   - native json values (e.g. bool, number, object, list)
+//   - strings containing json (e.g. "true", "42", "[{\"function_id\":\"foo\"}]")
+//   - camunda Json typed variables
+//   - camunda Null typed variables and empty strings, which are reported as found == false (except for string results)
+//
+// if result is a *string, string values are used as is and other values are json encoded
+func decodeVariable(variable model.CamundaVariable, result interface{}) (found bool, err error) {
+	value, found, err := variableValue(variable)
+	if !found || err != nil {
+		return found, err
+	}
+	if str, ok := value.(string); ok {
+		if target, isStr := result.(*string); isStr {
+			*target = str
+			return true, nil
+		}
+		if strings.TrimSpace(str) == "" {
+			return false, nil
+		}
+		return true, json.Unmarshal([]byte(str), result)
+	}
+	temp, err := json.Marshal(value)
+	if err != nil {
+		return true, err
+	}
+	if target, isStr := result.(*string); isStr {
+		*target = string(temp)
+		return true, nil
+	}
+	return true, json.Unmarshal(temp, result)
+}
+
+// variableValue returns the native value of a camunda variable
+// Null typed variables are reported as found == false; Json typed variables are unmarshalled
+func variableValue(variable model.CamundaVariable) (value interface{}, found bool, err error) {
+	if strings.ToLower(variable.Type) == "null" || variable.Value == nil {
+		return nil, false, nil
+	}
+	if strings.ToLower(variable.Type) == "json" {
+		if str, ok := variable.Value.(string); ok {
+			err = json.Unmarshal([]byte(str), &value)
+			return value, true, err
+		}
+	}
+	return variable.Value, true, nil
+}
+
+// isVariableSet returns true if the task has a variable with the given name, that is neither null nor an empty string
+// variables with values that can not be decoded count as set, so that the decoding error is reported
+func isVariableSet(task model.CamundaExternalTask, name string) bool {
+	variable, ok := task.Variables[name]
+	if !ok {
+		return false
+	}
+	value, found, err := variableValue(variable)
+	if err != nil {
+		return true
+	}
+	if str, isStr := value.(string); isStr && strings.TrimSpace(str) == "" {
+		return false
+	}
+	return found && value != nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a concurrency safe in-memory cache with a time-to-live and a maximum number of entries
+// if the cache is full, the oldest entry is evicted
+// cached values are shared between callers and must not be modified
+type Cache[V any] struct {
+	ttl     time.Duration
+	maxSize int
+	mux     sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List //oldest entry at the front
+}
+
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// New creates a Cache
+// ttl <= 0 keeps entries until they are evicted, maxSize <= 0 does not limit the number of entries
+func New[V any](ttl time.Duration, maxSize int) *Cache[V] {
+	return &Cache[V]{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (this *Cache[V]) Get(key string) (value V, ok bool) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	element, ok := this.entries[key]
+	if !ok {
+		return value, false
+	}
+	e := element.Value.(*entry[V])
+	if this.ttl > 0 && time.Now().After(e.expires) {
+		this.remove(element)
+		return value, false
+	}
+	return e.value, true
+}
+
+func (this *Cache[V]) Set(key string, value V) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if element, ok := this.entries[key]; ok {
+		this.remove(element)
+	}
+	for this.maxSize > 0 && this.order.Len() >= this.maxSize {
+		this.remove(this.order.Front())
+	}
+	this.entries[key] = this.order.PushBack(&entry[V]{key: key, value: value, expires: time.Now().Add(this.ttl)})
+}
+
+// Use returns the cached value of key or stores and returns the result of load
+// errors of load are not cached
+func (this *Cache[V]) Use(key string, load func() (V, error)) (value V, err error) {
+	value, ok := this.Get(key)
+	if ok {
+		return value, nil
+	}
+	value, err = load()
+	if err != nil {
+		return value, err
+	}
+	this.Set(key, value)
+	return value, nil
+}
+
+func (this *Cache[V]) Len() int {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.order.Len()
+}
+
+func (this *Cache[V]) remove(element *list.Element) {
+	this.order.Remove(element)
+	delete(this.entries, element.Value.(*entry[V]).key)
+}
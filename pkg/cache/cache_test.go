@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTtl(t *testing.T) {
+	c := New[string](200*time.Millisecond, 0)
+	c.Set("a", "1")
+	time.Sleep(100 * time.Millisecond)
+	c.Set("b", "2")
+
+	if value, ok := c.Get("a"); !ok || value != "1" {
+		t.Error("expected a before expiry", value, ok)
+	}
+	time.Sleep(140 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected a to be expired")
+	}
+	if value, ok := c.Get("b"); !ok || value != "2" {
+		t.Error("expected b before expiry", value, ok)
+	}
+	if c.Len() != 1 {
+		t.Error("expected expired entry to be removed on access", c.Len())
+	}
+
+	c.Set("b", "3") //refreshes the expiry
+	time.Sleep(140 * time.Millisecond)
+	if value, ok := c.Get("b"); !ok || value != "3" {
+		t.Error("expected overwritten b before expiry", value, ok)
+	}
+}
+
+func TestNoTtl(t *testing.T) {
+	c := New[string](0, 0)
+	c.Set("a", "1")
+	time.Sleep(10 * time.Millisecond)
+	if value, ok := c.Get("a"); !ok || value != "1" {
+		t.Error("expected a without ttl", value, ok)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	c := New[int](0, 3)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("a", 4) //overwrite moves a to the back
+	c.Set("d", 5) //evicts the oldest entry b
+
+	if c.Len() != 3 {
+		t.Error("unexpected len", c.Len())
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	for key, expected := range map[string]int{"a": 4, "c": 3, "d": 5} {
+		if value, ok := c.Get(key); !ok || value != expected {
+			t.Error("unexpected value", key, value, ok)
+		}
+	}
+
+	c.Set("e", 6) //evicts c
+	if _, ok := c.Get("c"); ok {
+		t.Error("expected c to be evicted")
+	}
+}
+
+func TestUse(t *testing.T) {
+	c := New[int](0, 0)
+	calls := 0
+	load := func() (int, error) {
+		calls++
+		return calls, nil
+	}
+	for i := 0; i < 3; i++ {
+		value, err := c.Use("a", load)
+		if err != nil || value != 1 {
+			t.Error("unexpected result", value, err)
+		}
+	}
+	if calls != 1 {
+		t.Error("expected one load, got", calls)
+	}
+
+	failures := 0
+	fail := func() (int, error) {
+		failures++
+		return 0, errors.New("test")
+	}
+	for i := 0; i < 2; i++ {
+		_, err := c.Use("b", fail)
+		if err == nil {
+			t.Error("expected error")
+		}
+	}
+	if failures != 2 {
+		t.Error("expected errors not to be cached, got", failures, "loads")
+	}
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected no entry for failed load")
+	}
+}
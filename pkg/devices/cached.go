@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package devices
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/cache"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+)
+
+// Repository is the part of the device repository used to resolve device and device-group selections
+type Repository interface {
+	GetDeviceGroup(ctx context.Context, token auth.Token, groupId string) (result DeviceGroup, err error)
+	GetDeviceInfosOfDevices(ctx context.Context, token auth.Token, deviceIds []string) (devices []Device, deviceTypeIds []string, unreadableDeviceIds []string, err error)
+	GetDevicesOfDeviceTypes(ctx context.Context, token auth.Token, deviceTypeIds []string) (devices []Device, err error)
+	GetDeviceTypeSelectables(ctx context.Context, token auth.Token, criteria []FilterCriteria, includeModified bool, servicesMustMatchAllCriteria bool) (result []DeviceTypeSelectable, err error)
+}
+
+// Cached is a Repository that caches the results of another Repository
+// results are cached per user, because the visible devices depend on the permissions of the user
+type Cached struct {
+	repo        Repository
+	groups      *cache.Cache[DeviceGroup]
+	deviceInfos *cache.Cache[deviceInfos]
+	typeDevices *cache.Cache[[]Device]
+	selectables *cache.Cache[[]DeviceTypeSelectable]
+}
+
+type deviceInfos struct {
+	devices             []Device
+	deviceTypeIds       []string
+	unreadableDeviceIds []string
+}
+
+// NewCached wraps repo in a Cached repository
+// ttl and maxSize apply to each method separately (see cache.New)
+func NewCached(repo Repository, ttl time.Duration, maxSize int) *Cached {
+	return &Cached{
+		repo:        repo,
+		groups:      cache.New[DeviceGroup](ttl, maxSize),
+		deviceInfos: cache.New[deviceInfos](ttl, maxSize),
+		typeDevices: cache.New[[]Device](ttl, maxSize),
+		selectables: cache.New[[]DeviceTypeSelectable](ttl, maxSize),
+	}
+}
+
+func (this *Cached) GetDeviceGroup(ctx context.Context, token auth.Token, groupId string) (result DeviceGroup, err error) {
+	return this.groups.Use(cacheKey(token, groupId), func() (DeviceGroup, error) {
+		return this.repo.GetDeviceGroup(ctx, token, groupId)
+	})
+}
+
+func (this *Cached) GetDeviceInfosOfDevices(ctx context.Context, token auth.Token, deviceIds []string) (devices []Device, deviceTypeIds []string, unreadableDeviceIds []string, err error) {
+	sortedIds := slices.Clone(deviceIds)
+	slices.Sort(sortedIds)
+	infos, err := this.deviceInfos.Use(cacheKey(token, slices.Compact(sortedIds)), func() (result deviceInfos, err error) {
+		result.devices, result.deviceTypeIds, result.unreadableDeviceIds, err = this.repo.GetDeviceInfosOfDevices(ctx, token, deviceIds)
+		return result, err
+	})
+	return infos.devices, infos.deviceTypeIds, infos.unreadableDeviceIds, err
+}
+
+func (this *Cached) GetDevicesOfDeviceTypes(ctx context.Context, token auth.Token, deviceTypeIds []string) (devices []Device, err error) {
+	sortedIds := slices.Clone(deviceTypeIds)
+	slices.Sort(sortedIds)
+	return this.typeDevices.Use(cacheKey(token, slices.Compact(sortedIds)), func() ([]Device, error) {
+		return this.repo.GetDevicesOfDeviceTypes(ctx, token, deviceTypeIds)
+	})
+}
+
+func (this *Cached) GetDeviceTypeSelectables(ctx context.Context, token auth.Token, criteria []FilterCriteria, includeModified bool, servicesMustMatchAllCriteria bool) (result []DeviceTypeSelectable, err error) {
+	return this.selectables.Use(cacheKey(token, criteria, includeModified, servicesMustMatchAllCriteria), func() ([]DeviceTypeSelectable, error) {
+		return this.repo.GetDeviceTypeSelectables(ctx, token, criteria, includeModified, servicesMustMatchAllCriteria)
+	})
+}
+
+// cacheKey combines the user of the token with the request parameters
+// the parameters are hashed to limit the key size of large device lists
+func cacheKey(token auth.Token, parameters ...interface{}) string {
+	temp, _ := json.Marshal(parameters)
+	hash := sha256.Sum256(temp)
+	return token.GetUserId() + "/" + hex.EncodeToString(hash[:])
+}
@@ -18,37 +18,51 @@ package devices
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/url"
 	"runtime/debug"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 
-	"github.com/SENERGY-Platform/device-repository/lib/client"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
 )
 
 type Devices struct {
 	deviceRepositoryUrl string
+	lookupChunkSize     int
+	lookupParallelism   int
+	client              *httpclient.Client
 }
 
-func New(deviceRepositoryUrl string) *Devices {
-	return &Devices{deviceRepositoryUrl: deviceRepositoryUrl}
-}
+// UpstreamDeviceRepository is the httpclient.UpstreamError.Upstream of device-repository errors
+const UpstreamDeviceRepository = "device-repository"
 
-func (this *Devices) GetDeviceInfosOfGroup(token auth.Token, groupId string) (devices []Device, deviceTypeIds []string, err error) {
-	group, err := this.GetDeviceGroup(token, groupId)
-	if err != nil {
-		return devices, nil, err
+const DefaultLookupChunkSize = 100
+const DefaultLookupParallelism = 4
+
+// New creates a device repository client
+// device id lookups are split in chunks of lookupChunkSize ids, of which at most lookupParallelism are requested concurrently
+// values <= 0 select DefaultLookupChunkSize and DefaultLookupParallelism
+func New(deviceRepositoryUrl string, lookupChunkSize int, lookupParallelism int, client *httpclient.Client) *Devices {
+	if lookupChunkSize <= 0 {
+		lookupChunkSize = DefaultLookupChunkSize
 	}
-	return this.GetDeviceInfosOfDevices(token, group.DeviceIds)
+	if lookupParallelism <= 0 {
+		lookupParallelism = DefaultLookupParallelism
+	}
+	return &Devices{deviceRepositoryUrl: deviceRepositoryUrl, lookupChunkSize: lookupChunkSize, lookupParallelism: lookupParallelism, client: client}
 }
 
-func (this *Devices) GetDeviceInfosOfDevices(token auth.Token, deviceIds []string) (devices []Device, deviceTypeIds []string, err error) {
-	devices, err = this.GetDevicesWithIds(token, deviceIds)
+func (this *Devices) GetDeviceInfosOfDevices(ctx context.Context, token auth.Token, deviceIds []string) (devices []Device, deviceTypeIds []string, unreadableDeviceIds []string, err error) {
+	devices, unreadableDeviceIds, err = this.GetDevicesWithIds(ctx, token, deviceIds)
 	if err != nil {
-		return devices, nil, err
+		return devices, nil, nil, err
 	}
 	deviceTypeIsUsed := map[string]bool{}
 	for _, d := range devices {
@@ -57,42 +71,137 @@ func (this *Devices) GetDeviceInfosOfDevices(token auth.Token, deviceIds []strin
 			deviceTypeIds = append(deviceTypeIds, d.DeviceTypeId)
 		}
 	}
-	return devices, deviceTypeIds, nil
+	return devices, deviceTypeIds, unreadableDeviceIds, nil
+}
+
+func (this *Devices) GetDeviceGroup(ctx context.Context, token auth.Token, groupId string) (result DeviceGroup, err error) {
+	err = this.get(ctx, token, "/device-groups/"+url.PathEscape(groupId), &result)
+	return result, err
 }
 
-func (this *Devices) GetDeviceGroup(token auth.Token, groupId string) (result DeviceGroup, err error) {
-	dg, err, _ := client.NewClient(this.deviceRepositoryUrl, nil).ReadDeviceGroup(groupId, token.Jwt(), false)
+// GetDevicesWithIds returns the devices with the given ids, sorted by name and id
+// the ids are requested in chunks, to stay within url length and page size limits of the device repository
+// unreadableIds contains the requested ids the user may not read (or that do not exist)
+func (this *Devices) GetDevicesWithIds(ctx context.Context, token auth.Token, ids []string) (result []Device, unreadableIds []string, err error) {
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	found, err := this.lookupChunks(ctx, token, ids, this.getDevicesWithIdsChunk)
 	if err != nil {
-		return result, err
+		return result, nil, err
+	}
+	isRequested := map[string]bool{}
+	for _, id := range ids {
+		isRequested[id] = true
+	}
+	isReadable := map[string]bool{}
+	for _, device := range found {
+		if isRequested[device.Id] && !isReadable[device.Id] {
+			isReadable[device.Id] = true
+			result = append(result, device)
+		}
+	}
+	sortDevices(result)
+	for _, id := range ids {
+		if !isReadable[id] {
+			unreadableIds = append(unreadableIds, id)
+		}
 	}
-	return DeviceGroup{
-		Id:        dg.Id,
-		Name:      dg.Name,
-		DeviceIds: dg.DeviceIds,
-	}, nil
+	return result, unreadableIds, nil
 }
 
-func (this *Devices) GetDevicesWithIds(token auth.Token, ids []string) (result []Device, err error) {
-	device, err, _ := client.NewClient(this.deviceRepositoryUrl, nil).ListDevices(token.Jwt(), client.DeviceListOptions{
-		Ids:    ids,
-		Limit:  int64(len(ids)),
-		Offset: 0,
-		SortBy: "name.asc",
-	})
+func (this *Devices) getDevicesWithIdsChunk(ctx context.Context, token auth.Token, ids []string) (result []Device, err error) {
+	query := url.Values{}
+	query.Set("ids", strings.Join(ids, ","))
+	query.Set("limit", strconv.Itoa(len(ids)))
+	query.Set("sort", "name.asc")
+	err = this.get(ctx, token, "/devices?"+query.Encode(), &result)
+	return result, err
+}
+
+// GetDevicesOfDeviceTypes returns all devices the user may read, that use one of the given device-types, sorted by name and id
+// the device-type ids are requested in chunks (see GetDevicesWithIds)
+func (this *Devices) GetDevicesOfDeviceTypes(ctx context.Context, token auth.Token, deviceTypeIds []string) (result []Device, err error) {
+	if len(deviceTypeIds) == 0 {
+		return []Device{}, nil
+	}
+	deviceTypeIds = slices.Compact(slices.Sorted(slices.Values(deviceTypeIds)))
+	found, err := this.lookupChunks(ctx, token, deviceTypeIds, this.getDevicesOfDeviceTypesChunk)
 	if err != nil {
 		return result, err
 	}
-	for _, d := range device {
-		result = append(result, Device{
-			Id:           d.Id,
-			Name:         d.Name,
-			DeviceTypeId: d.DeviceTypeId,
-		})
+	isRequestedDeviceType := map[string]bool{}
+	for _, id := range deviceTypeIds {
+		isRequestedDeviceType[id] = true
+	}
+	isUsed := map[string]bool{}
+	for _, d := range found {
+		if isRequestedDeviceType[d.DeviceTypeId] && !isUsed[d.Id] {
+			isUsed[d.Id] = true
+			result = append(result, d)
+		}
 	}
+	sortDevices(result)
 	return result, nil
 }
 
-func (this *Devices) GetDeviceTypeSelectables(token auth.Token, criteria []FilterCriteria, includeModified bool, servicesMustMatchAllCriteria bool) (result []DeviceTypeSelectable, err error) {
+func (this *Devices) getDevicesOfDeviceTypesChunk(ctx context.Context, token auth.Token, deviceTypeIds []string) (result []Device, err error) {
+	limit := 1000
+	offset := 0
+	for {
+		query := url.Values{}
+		query.Set("device-type-ids", strings.Join(deviceTypeIds, ","))
+		query.Set("limit", strconv.Itoa(limit))
+		if offset > 0 {
+			query.Set("offset", strconv.Itoa(offset))
+		}
+		query.Set("sort", "name.asc")
+		page := []Device{}
+		err = this.get(ctx, token, "/devices?"+query.Encode(), &page)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, page...)
+		if len(page) < limit {
+			return result, nil
+		}
+		offset = offset + limit
+	}
+}
+
+// lookupChunks calls lookup for chunks of lookupChunkSize ids, with at most lookupParallelism concurrent calls
+// the results are concatenated in chunk order
+func (this *Devices) lookupChunks(ctx context.Context, token auth.Token, ids []string, lookup func(ctx context.Context, token auth.Token, chunk []string) ([]Device, error)) (result []Device, err error) {
+	chunks := slices.Collect(slices.Chunk(ids, this.lookupChunkSize))
+	chunkResults := make([][]Device, len(chunks))
+	chunkErrors := make([]error, len(chunks))
+	semaphore := make(chan struct{}, this.lookupParallelism)
+	wg := sync.WaitGroup{}
+	for i, chunk := range chunks {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			chunkResults[i], chunkErrors[i] = lookup(ctx, token, chunk)
+		}()
+	}
+	wg.Wait()
+	err = errors.Join(chunkErrors...)
+	if err != nil {
+		return result, err
+	}
+	return slices.Concat(chunkResults...), nil
+}
+
+func sortDevices(devices []Device) {
+	slices.SortStableFunc(devices, func(a, b Device) int {
+		if a.Name != b.Name {
+			return strings.Compare(a.Name, b.Name)
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+}
+
+func (this *Devices) GetDeviceTypeSelectables(ctx context.Context, token auth.Token, criteria []FilterCriteria, includeModified bool, servicesMustMatchAllCriteria bool) (result []DeviceTypeSelectable, err error) {
 	requestBody := new(bytes.Buffer)
 	err = json.NewEncoder(requestBody).Encode(criteria)
 	if err != nil {
@@ -101,23 +210,20 @@ func (this *Devices) GetDeviceTypeSelectables(token auth.Token, criteria []Filte
 	query := url.Values{}
 	query.Set("services_must_match_all_criteria", strconv.FormatBool(servicesMustMatchAllCriteria))
 	query.Set("include_id_modified", strconv.FormatBool(includeModified))
-	req, err := http.NewRequest("POST", this.deviceRepositoryUrl+"/v2/query/device-type-selectables?"+query.Encode(), requestBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", this.deviceRepositoryUrl+"/v2/query/device-type-selectables?"+query.Encode(), requestBody)
 	if err != nil {
 		debug.PrintStack()
 		return result, err
 	}
 	req.Header.Set("Authorization", token.Jwt())
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := this.client.Do(httpclient.Idempotent(req)) //read only query
 	if err != nil {
-		return result, err
+		return result, httpclient.NewRequestError(ctx, UpstreamDeviceRepository, err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(resp.Body)
-		err = errors.New(buf.String())
-		return result, err
+		return result, httpclient.NewResponseError(UpstreamDeviceRepository, resp, nil)
 	}
 	err = json.NewDecoder(resp.Body).Decode(&result)
 	if err != nil {
@@ -126,3 +232,20 @@ func (this *Devices) GetDeviceTypeSelectables(token auth.Token, criteria []Filte
 
 	return result, nil
 }
+
+func (this *Devices) get(ctx context.Context, token auth.Token, path string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, this.deviceRepositoryUrl+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", token.Jwt())
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return httpclient.NewRequestError(ctx, UpstreamDeviceRepository, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return httpclient.NewResponseError(UpstreamDeviceRepository, resp, nil)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
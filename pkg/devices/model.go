@@ -47,6 +47,7 @@ type PathOptionsResultElement struct {
 	ServiceId              string            `json:"service_id"`
 	JsonPath               []string          `json:"json_path"`
 	PathToCharacteristicId map[string]string `json:"path_to_characteristic_id"`
+	PathToAspectId         map[string]string `json:"path_to_aspect_id"`
 }
 
 type DeviceTypeSelectable struct {
@@ -56,10 +57,10 @@ type DeviceTypeSelectable struct {
 }
 
 type ServicePathOption struct {
-	ServiceId        string `json:"service_id"`
-	Path             string `json:"path"`
-	CharacteristicId string `json:"characteristic_id"`
-	//AspectNode            AspectNode     `json:"aspect_node"`
+	ServiceId             string      `json:"service_id"`
+	Path                  string      `json:"path"`
+	CharacteristicId      string      `json:"characteristic_id"`
+	AspectNode            AspectNode  `json:"aspect_node"`
 	FunctionId            string      `json:"function_id"`
 	IsVoid                bool        `json:"is_void"`
 	Value                 interface{} `json:"value,omitempty"`
@@ -67,3 +68,13 @@ type ServicePathOption struct {
 	//Configurables         []Configurable `json:"configurables,omitempty"`
 	//Type                  Type           `json:"type,omitempty"`
 }
+
+type AspectNode struct {
+	Id            string   `json:"id"`
+	Name          string   `json:"name"`
+	RootId        string   `json:"root_id"`
+	ParentId      string   `json:"parent_id"`
+	ChildIds      []string `json:"child_ids"`
+	AncestorIds   []string `json:"ancestor_ids"`
+	DescendentIds []string `json:"descendent_ids"`
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrForbidden           = errors.New("forbidden")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+)
+
+// transientStatusCodes are the status codes of responses, that may succeed if the request is repeated later
+// the Client retries them and NewResponseError classifies them as ErrUpstreamUnavailable
+var transientStatusCodes = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// UpstreamErrorBodyLimit is the maximum number of response body bytes kept in UpstreamError.Body
+const UpstreamErrorBodyLimit = 1024
+
+// UpstreamError describes a failed request to an upstream service
+// callers may use errors.As to read the details or errors.Is to check the Kind (e.g. ErrForbidden)
+type UpstreamError struct {
+	Upstream   string //e.g. "flow-engine"
+	StatusCode int    //0 if no response was received
+	Body       string //excerpt of the response body
+	Kind       error  //one of the Err... values or nil
+	Cause      error  //transport error, if no response was received
+}
+
+func (this *UpstreamError) Error() string {
+	parts := []string{this.Upstream}
+	if this.Kind != nil {
+		parts = append(parts, this.Kind.Error())
+	}
+	if this.StatusCode != 0 {
+		parts = append(parts, fmt.Sprintf("unexpected statuscode %v", this.StatusCode))
+	}
+	if this.Body != "" {
+		parts = append(parts, this.Body)
+	}
+	if this.Cause != nil {
+		parts = append(parts, this.Cause.Error())
+	}
+	return strings.Join(parts, ": ")
+}
+
+func (this *UpstreamError) Unwrap() (result []error) {
+	if this.Kind != nil {
+		result = append(result, this.Kind)
+	}
+	if this.Cause != nil {
+		result = append(result, this.Cause)
+	}
+	return result
+}
+
+// NewResponseError reads an excerpt of the response body and classifies the status code
+// 401 and 403 are ErrForbidden, 429, 502, 503 and 504 are ErrUpstreamUnavailable, other codes (e.g. 500) have no Kind
+// statusKinds maps request specific status codes to a Kind (e.g. 404 to a "not found" error of the caller)
+func NewResponseError(upstream string, resp *http.Response, statusKinds map[int]error) *UpstreamError {
+	temp, _ := io.ReadAll(io.LimitReader(resp.Body, UpstreamErrorBodyLimit+1))
+	_, _ = io.Copy(io.Discard, resp.Body)
+	body := string(temp)
+	if len(temp) > UpstreamErrorBodyLimit {
+		body = strings.ToValidUTF8(string(temp[:UpstreamErrorBodyLimit]), "") + "..."
+	} else if !utf8.ValidString(body) {
+		body = strings.ToValidUTF8(body, "")
+	}
+	result := &UpstreamError{
+		Upstream:   upstream,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(body),
+		Kind:       statusKinds[resp.StatusCode],
+	}
+	if result.Kind == nil {
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			result.Kind = ErrForbidden
+		case transientStatusCodes[resp.StatusCode]:
+			result.Kind = ErrUpstreamUnavailable
+		}
+	}
+	return result
+}
+
+// NewRequestError wraps an error of a request without response
+// errors the Client would retry (timeouts, failed dials, dropped connections) are classified as ErrUpstreamUnavailable,
+// unless they are caused by the cancelled or expired request context ctx;
+// client timeouts of a single attempt (Config.Timeout) are transient, although they also wrap context.DeadlineExceeded
+// other errors (e.g. tls failures or invalid urls) are permanent
+func NewRequestError(ctx context.Context, upstream string, err error) *UpstreamError {
+	result := &UpstreamError{Upstream: upstream, Cause: err}
+	if ctx.Err() == nil && isTransientNetworkError(err) {
+		result.Kind = ErrUpstreamUnavailable
+	}
+	return result
+}
+
+// IsTransientError returns true if err may disappear if the request is repeated later (ErrUpstreamUnavailable)
+// all other errors (e.g. invalid parameters, ErrForbidden, unknown resources) need user interaction
+func IsTransientError(err error) bool {
+	return errors.Is(err, ErrUpstreamUnavailable)
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const DefaultTimeout = 30 * time.Second
+const DefaultInitialBackoff = 100 * time.Millisecond
+const DefaultMaxBackoff = 2 * time.Second
+
+type Config struct {
+	Timeout        time.Duration //timeout of a single attempt; <= 0 selects DefaultTimeout
+	MaxRetries     int           //retries of idempotent requests; <= 0 disables retries
+	InitialBackoff time.Duration //backoff before the first retry, doubled for every further retry; <= 0 selects DefaultInitialBackoff
+	MaxBackoff     time.Duration //<= 0 selects DefaultMaxBackoff
+}
+
+// Client sends requests to one upstream service
+// idempotent requests (see IsIdempotent) are retried with exponential backoff and full jitter
+// if the upstream times out, is unreachable, drops the connection or responds with 429, 502, 503 or 504
+type Client struct {
+	client         *http.Client
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// NewTransport creates a pooled transport, that should be shared by all clients
+func NewTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 20
+	transport.IdleConnTimeout = 90 * time.Second
+	return transport
+}
+
+func New(transport http.RoundTripper, config Config) *Client {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = DefaultInitialBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	return &Client{
+		client:         &http.Client{Transport: transport, Timeout: config.Timeout},
+		maxRetries:     config.MaxRetries,
+		initialBackoff: config.InitialBackoff,
+		maxBackoff:     config.MaxBackoff,
+	}
+}
+
+type idempotentKey struct{}
+
+// Idempotent marks a request with a non-idempotent method (e.g. a POST query) as safe to retry
+func Idempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+// IsIdempotent returns true for GET, HEAD, OPTIONS, PUT and DELETE requests and requests marked with Idempotent
+func IsIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+func (this *Client) Do(req *http.Request) (resp *http.Response, err error) {
+	retries := 0
+	if IsIdempotent(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) {
+		retries = this.maxRetries
+	}
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			attemptReq = req.Clone(req.Context())
+			if req.GetBody != nil {
+				attemptReq.Body, err = req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		resp, err = this.client.Do(attemptReq)
+		if attempt >= retries || !isRetryable(req.Context(), resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(this.backoff(attempt)):
+		}
+	}
+}
+
+// backoff returns a random duration between 0 and initialBackoff * 2^attempt (at most maxBackoff)
+func (this *Client) backoff(attempt int) time.Duration {
+	limit := this.initialBackoff
+	for i := 0; i < attempt && limit < this.maxBackoff; i++ {
+		limit = limit * 2
+	}
+	return rand.N(min(limit, this.maxBackoff))
+}
+
+func isRetryable(ctx context.Context, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return isTransientNetworkError(err)
+	}
+	return transientStatusCodes[resp.StatusCode]
+}
+
+// isTransientNetworkError returns true for timeouts, failed dials, refused or reset connections
+// and connections closed before a complete response
+// other request errors (e.g. tls failures or unsupported url schemes) will not succeed if repeated
+func isTransientNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
@@ -0,0 +1,361 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer responds with the given status codes in order (200 once they are used up) and records the request bodies
+type testServer struct {
+	*httptest.Server
+	mux      sync.Mutex
+	statuses []int
+	bodies   []string
+}
+
+func newTestServer(t *testing.T, statuses ...int) *testServer {
+	server := &testServer{statuses: statuses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		server.mux.Lock()
+		server.bodies = append(server.bodies, string(body))
+		status := http.StatusOK
+		if len(server.statuses) > 0 {
+			status = server.statuses[0]
+			server.statuses = server.statuses[1:]
+		}
+		server.mux.Unlock()
+		writer.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (this *testServer) requests() []string {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.bodies
+}
+
+func testConfig(maxRetries int) Config {
+	return Config{Timeout: time.Second, MaxRetries: maxRetries, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+}
+
+func TestRetryTransientStatus(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+		server := newTestServer(t, status, status)
+		client := New(NewTransport(), testConfig(3))
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Error("unexpected status", status, resp.StatusCode)
+		}
+		if count := len(server.requests()); count != 3 {
+			t.Error("expected 3 attempts for", status, "got", count)
+		}
+	}
+}
+
+func TestRetryLimit(t *testing.T) {
+	server := newTestServer(t, 503, 503, 503, 503, 503)
+	client := New(NewTransport(), testConfig(2))
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Error("expected the last response to be returned", resp.StatusCode)
+	}
+	if count := len(server.requests()); count != 3 {
+		t.Error("expected 3 attempts, got", count)
+	}
+}
+
+func TestNoRetry(t *testing.T) {
+	t.Run("client error", func(t *testing.T) {
+		server := newTestServer(t, http.StatusBadRequest)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		checkAttempts(t, server, req, 3, 1, http.StatusBadRequest)
+	})
+	t.Run("internal server error", func(t *testing.T) {
+		server := newTestServer(t, http.StatusInternalServerError)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		checkAttempts(t, server, req, 3, 1, http.StatusInternalServerError)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		server := newTestServer(t, http.StatusServiceUnavailable)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		checkAttempts(t, server, req, 0, 1, http.StatusServiceUnavailable)
+	})
+	t.Run("post", func(t *testing.T) {
+		server := newTestServer(t, http.StatusServiceUnavailable)
+		req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("body"))
+		checkAttempts(t, server, req, 3, 1, http.StatusServiceUnavailable)
+	})
+	t.Run("idempotent post without GetBody", func(t *testing.T) {
+		server := newTestServer(t, http.StatusServiceUnavailable)
+		req, _ := http.NewRequest(http.MethodPost, server.URL, io.NopCloser(strings.NewReader("body")))
+		checkAttempts(t, server, Idempotent(req), 3, 1, http.StatusServiceUnavailable)
+	})
+}
+
+// countingTransport counts the attempts of a client
+type countingTransport struct {
+	http.RoundTripper
+	mux      sync.Mutex
+	attempts int
+}
+
+func (this *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	this.mux.Lock()
+	this.attempts++
+	this.mux.Unlock()
+	return this.RoundTripper.RoundTrip(req)
+}
+
+func TestNoRetryPermanentRequestError(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	defer tlsServer.Close()
+
+	for name, url := range map[string]string{
+		"untrusted certificate": tlsServer.URL,
+		"unsupported scheme":    "ftp://localhost/file",
+		"tls to plain server":   strings.Replace(newTestServer(t).URL, "http://", "https://", 1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			transport := &countingTransport{RoundTripper: NewTransport()}
+			req, _ := http.NewRequest(http.MethodGet, url, nil)
+			_, err := New(transport, testConfig(3)).Do(req)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if transport.attempts != 1 {
+				t.Error("expected 1 attempt, got", transport.attempts, err)
+			}
+		})
+	}
+}
+
+func checkAttempts(t *testing.T, server *testServer, req *http.Request, maxRetries int, expectedAttempts int, expectedStatus int) {
+	t.Helper()
+	resp, err := New(NewTransport(), testConfig(maxRetries)).Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != expectedStatus {
+		t.Error("unexpected status", resp.StatusCode, expectedStatus)
+	}
+	if count := len(server.requests()); count != expectedAttempts {
+		t.Error("unexpected number of attempts", count, expectedAttempts)
+	}
+}
+
+func TestIdempotentPostReplaysBody(t *testing.T) {
+	server := newTestServer(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	client := New(NewTransport(), testConfig(3))
+	req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte(`{"query":true}`)))
+	resp, err := client.Do(Idempotent(req))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Error("unexpected status", resp.StatusCode)
+	}
+	bodies := server.requests()
+	if len(bodies) != 3 {
+		t.Error("expected 3 attempts, got", len(bodies))
+	}
+	for _, body := range bodies {
+		if body != `{"query":true}` {
+			t.Error("unexpected body", body)
+		}
+	}
+}
+
+func TestRetryConnectionError(t *testing.T) {
+	attempts := 0
+	mux := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mux.Lock()
+		attempts++
+		first := attempts == 1
+		mux.Unlock()
+		if first {
+			//close the connection without response
+			conn, _, err := writer.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := New(NewTransport(), testConfig(3)).Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || attempts != 2 {
+		t.Error("unexpected result", resp.StatusCode, attempts)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	attempts := 0
+	mux := sync.Mutex{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mux.Lock()
+		attempts++
+		first := attempts == 1
+		mux.Unlock()
+		if first {
+			time.Sleep(200 * time.Millisecond)
+		}
+		writer.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	config := testConfig(3)
+	config.Timeout = 50 * time.Millisecond
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := New(NewTransport(), config).Do(req)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || attempts != 2 {
+		t.Error("unexpected result", resp.StatusCode, attempts)
+	}
+}
+
+func TestContextCancelDuringBackoff(t *testing.T) {
+	server := newTestServer(t, 503, 503, 503)
+	config := testConfig(3)
+	config.InitialBackoff = time.Minute
+	config.MaxBackoff = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	start := time.Now()
+	_, err := New(NewTransport(), config).Do(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected context error, got", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("backoff was not interrupted by the context")
+	}
+	if count := len(server.requests()); count > 2 {
+		t.Error("unexpected number of attempts", count)
+	}
+}
+
+func TestIsIdempotent(t *testing.T) {
+	for method, expected := range map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		http.MethodPut:     true,
+		http.MethodDelete:  true,
+		http.MethodPost:    false,
+		http.MethodPatch:   false,
+	} {
+		req, _ := http.NewRequest(method, "http://localhost", nil)
+		if IsIdempotent(req) != expected {
+			t.Error("unexpected result for", method)
+		}
+		if !IsIdempotent(Idempotent(req)) {
+			t.Error("expected marked request to be idempotent", method)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	client := New(NewTransport(), Config{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+	for attempt, limit := range []time.Duration{10, 20, 40, 50, 50, 50} {
+		limit = limit * time.Millisecond
+		for i := 0; i < 100; i++ {
+			backoff := client.backoff(attempt)
+			if backoff < 0 || backoff >= limit {
+				t.Error("backoff out of range", attempt, backoff, limit)
+				return
+			}
+		}
+	}
+}
+
+func TestNewRequestError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	config := testConfig(0)
+	config.Timeout = 50 * time.Millisecond
+	client := New(NewTransport(), config)
+
+	t.Run("client timeout", func(t *testing.T) {
+		ctx := context.Background()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		_, err := client.Do(req)
+		if err == nil {
+			t.Fatal("expected timeout")
+		}
+		if !IsTransientError(NewRequestError(ctx, "test", err)) {
+			t.Error("expected transient error", err)
+		}
+	})
+
+	t.Run("request context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		_, err := client.Do(req)
+		if err == nil {
+			t.Fatal("expected timeout")
+		}
+		if IsTransientError(NewRequestError(ctx, "test", err)) {
+			t.Error("expected non transient error", err)
+		}
+	})
+}
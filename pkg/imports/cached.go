@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package imports
+
+import (
+	"context"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/cache"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+)
+
+// Repository is the part of the import-deploy and import-repository services used to resolve import selections
+type Repository interface {
+	GetImport(ctx context.Context, token auth.Token, importId string) (result Import, err error)
+	GetImports(ctx context.Context, token auth.Token, importIds []string) (result map[string]Import, err error)
+	GetImportType(ctx context.Context, token auth.Token, importTypeId string) (result ImportType, err error)
+}
+
+// Cached is a Repository that caches the results of another Repository per user
+type Cached struct {
+	repo        Repository
+	instances   *cache.Cache[Import]
+	importTypes *cache.Cache[ImportType]
+}
+
+// NewCached wraps repo in a Cached repository
+// ttl and maxSize apply to import instances and import types separately (see cache.New)
+func NewCached(repo Repository, ttl time.Duration, maxSize int) *Cached {
+	return &Cached{
+		repo:        repo,
+		instances:   cache.New[Import](ttl, maxSize),
+		importTypes: cache.New[ImportType](ttl, maxSize),
+	}
+}
+
+func (this *Cached) GetImport(ctx context.Context, token auth.Token, importId string) (result Import, err error) {
+	if importInstance, ok := this.instances.Get(token.GetUserId() + "/" + importId); ok {
+		return importInstance, nil
+	}
+	result, err = this.repo.GetImport(ctx, token, importId)
+	if err != nil {
+		return result, err
+	}
+	this.setInstance(token, importId, result)
+	return result, nil
+}
+
+// setInstance caches deployed import instances
+// instances without kafka topic are not deployed yet and are requested again, until the user deploys them
+func (this *Cached) setInstance(token auth.Token, importId string, importInstance Import) {
+	if importInstance.KafkaTopic == "" {
+		return
+	}
+	this.instances.Set(token.GetUserId()+"/"+importId, importInstance)
+}
+
+// GetImports only requests the imports missing in the cache
+func (this *Cached) GetImports(ctx context.Context, token auth.Token, importIds []string) (result map[string]Import, err error) {
+	result = map[string]Import{}
+	missing := []string{}
+	for _, id := range importIds {
+		if importInstance, ok := this.instances.Get(token.GetUserId() + "/" + id); ok {
+			result[id] = importInstance
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+	fetched, err := this.repo.GetImports(ctx, token, missing)
+	if err != nil {
+		return result, err
+	}
+	for id, importInstance := range fetched {
+		this.setInstance(token, id, importInstance)
+		result[id] = importInstance
+	}
+	return result, nil
+}
+
+func (this *Cached) GetImportType(ctx context.Context, token auth.Token, importTypeId string) (result ImportType, err error) {
+	return this.importTypes.Use(token.GetUserId()+"/"+importTypeId, func() (ImportType, error) {
+		return this.repo.GetImportType(ctx, token, importTypeId)
+	})
+}
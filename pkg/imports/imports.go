@@ -17,43 +17,101 @@
 package imports
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
-	"io"
 	"net/http"
 	"net/url"
+	"slices"
+	"sync"
 )
 
 type Imports struct {
-	importDeployUrl string
+	importDeployUrl     string
+	importRepositoryUrl string
+	client              *httpclient.Client
 }
 
-func New(importDeployUrl string) *Imports {
-	return &Imports{importDeployUrl: importDeployUrl}
+// Upstream values of the httpclient.UpstreamError returned by Imports
+const (
+	UpstreamImportDeploy     = "import-deploy"
+	UpstreamImportRepository = "import-repository"
+)
+
+func New(importDeployUrl string, importRepositoryUrl string, client *httpclient.Client) *Imports {
+	return &Imports{importDeployUrl: importDeployUrl, importRepositoryUrl: importRepositoryUrl, client: client}
+}
+
+// LookupParallelism is the maximum number of concurrent requests of GetImports
+const LookupParallelism = 4
+
+// GetImports returns the import instances with the given ids, duplicate ids are requested once
+// at most LookupParallelism requests run concurrently, further ids wait for a free slot
+func (this *Imports) GetImports(ctx context.Context, token auth.Token, importIds []string) (result map[string]Import, err error) {
+	importIds = slices.Compact(slices.Sorted(slices.Values(importIds)))
+	results := make([]Import, len(importIds))
+	errs := make([]error, len(importIds))
+	semaphore := make(chan struct{}, LookupParallelism)
+	wg := sync.WaitGroup{}
+	for i, id := range importIds {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i], errs[i] = this.GetImport(ctx, token, id)
+		}()
+	}
+	wg.Wait()
+	err = errors.Join(errs...)
+	if err != nil {
+		return result, err
+	}
+	result = map[string]Import{}
+	for i, id := range importIds {
+		result[id] = results[i]
+	}
+	return result, nil
+}
+
+func (this *Imports) GetImport(ctx context.Context, token auth.Token, importId string) (result Import, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", this.importDeployUrl+"/instances/"+url.PathEscape(importId), nil)
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Authorization", token.Jwt())
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := this.client.Do(req)
+	if err != nil {
+		return result, httpclient.NewRequestError(ctx, UpstreamImportDeploy, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return result, httpclient.NewResponseError(UpstreamImportDeploy, resp, nil)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
 }
 
-func (this *Imports) GetTopic(token auth.Token, importId string) (topic string, err error) {
-	req, err := http.NewRequest("GET", this.importDeployUrl+"/instances/"+url.PathEscape(importId), nil)
+func (this *Imports) GetImportType(ctx context.Context, token auth.Token, importTypeId string) (result ImportType, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", this.importRepositoryUrl+"/import-types/"+url.PathEscape(importTypeId), nil)
 	if err != nil {
-		return "", err
+		return result, err
 	}
 	req.Header.Set("Authorization", token.Jwt())
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := this.client.Do(req)
 	if err != nil {
-		return "", err
+		return result, httpclient.NewRequestError(ctx, UpstreamImportRepository, err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		temp, _ := io.ReadAll(resp.Body)
-		err = errors.New(string(temp))
-		return "", err
+		return result, httpclient.NewResponseError(UpstreamImportRepository, resp, nil)
 	}
-	var importInstance Import
-	err = json.NewDecoder(resp.Body).Decode(&importInstance)
-	topic = importInstance.KafkaTopic
-	return topic, err
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
 }
 
 type Import struct {
@@ -65,3 +123,23 @@ type Import struct {
 	//Configs      []ImportConfig `json:"configs"`
 	Restart *bool `json:"restart"`
 }
+
+type ImportType struct {
+	Id          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Image       string          `json:"image"`
+	Output      ContentVariable `json:"output"`
+	//Configs        []ImportConfig `json:"configs"`
+	//DefaultRestart *bool          `json:"default_restart"`
+}
+
+type ContentVariable struct {
+	Id                  string            `json:"id"`
+	Name                string            `json:"name"`
+	Type                string            `json:"type"`
+	SubContentVariables []ContentVariable `json:"sub_content_variables"`
+	CharacteristicId    string            `json:"characteristic_id"`
+	FunctionId          string            `json:"function_id,omitempty"`
+	AspectId            string            `json:"aspect_id,omitempty"`
+}
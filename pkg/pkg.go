@@ -24,6 +24,7 @@ import (
 
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/analytics"
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/imports"
 	lib "github.com/SENERGY-Platform/smart-service-module-worker-lib"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
@@ -55,13 +56,61 @@ func getPipelineId(moduleData map[string]interface{}) (string, error) {
 
 func Start(ctx context.Context, wg *sync.WaitGroup, config analytics.Config, libConfig configuration.Config) error {
 	handlerFactory := func(auth *auth.Auth, smartServiceRepo *smartservicerepository.SmartServiceRepository) (camunda.Handler, error) {
+		_, _, err := config.GetTaskRetryBackoff()
+		if err != nil {
+			return nil, err
+		}
+		transport := httpclient.NewTransport()
+		newClient := func(upstreamTimeout string) (*httpclient.Client, error) {
+			clientConfig, err := config.GetHttpClientConfig(upstreamTimeout)
+			if err != nil {
+				return nil, err
+			}
+			return httpclient.New(transport, clientConfig), nil
+		}
+		flowEngineClient, err := newClient(config.FlowEngineTimeout)
+		if err != nil {
+			return nil, err
+		}
+		flowParserClient, err := newClient(config.FlowParserTimeout)
+		if err != nil {
+			return nil, err
+		}
+		deviceRepoClient, err := newClient(config.DeviceRepositoryTimeout)
+		if err != nil {
+			return nil, err
+		}
+		importClient, err := newClient(config.ImportTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		var deviceRepo analytics.Devices = devices.New(config.DeviceRepositoryUrl, config.DeviceLookupChunkSize, config.DeviceLookupParallelism, deviceRepoClient)
+		deviceCacheTtl, err := config.GetDeviceCacheTtl()
+		if err != nil {
+			return nil, err
+		}
+		if deviceCacheTtl > 0 {
+			deviceRepo = devices.NewCached(deviceRepo, deviceCacheTtl, config.DeviceCacheSize)
+		}
+		var importRepo analytics.Imports = imports.New(config.ImportDeployUrl, config.ImportRepositoryUrl, importClient)
+		importCacheTtl, err := config.GetImportCacheTtl()
+		if err != nil {
+			return nil, err
+		}
+		if importCacheTtl > 0 {
+			importRepo = imports.NewCached(importRepo, importCacheTtl, config.ImportCacheSize)
+		}
 		handler := analytics.New(
+			ctx,
 			config,
 			libConfig,
 			auth,
 			smartServiceRepo,
-			imports.New(config.ImportDeployUrl),
-			devices.New(config.DeviceRepositoryUrl),
+			importRepo,
+			deviceRepo,
+			flowEngineClient,
+			flowParserClient,
 		)
 		interval, err := time.ParseDuration(config.HealthCheckInterval)
 		if err != nil {
@@ -69,6 +118,7 @@ func Start(ctx context.Context, wg *sync.WaitGroup, config analytics.Config, lib
 		}
 
 		healthCheck := func(module model.SmartServiceModule) (health error, err error) {
+			handler.AddReconcileInstance(module.InstanceId)
 			token, err := auth.ExchangeUserToken(module.UserId)
 			if err != nil {
 				return nil, err
@@ -77,7 +127,7 @@ func Start(ctx context.Context, wg *sync.WaitGroup, config analytics.Config, lib
 			if err != nil {
 				return nil, err
 			}
-			state, code, err := handler.CheckPipeline(token, pipelineId)
+			state, code, err := handler.CheckPipeline(ctx, token, pipelineId)
 			if err != nil {
 				if code == 0 {
 					return nil, err
@@ -92,6 +142,14 @@ func Start(ctx context.Context, wg *sync.WaitGroup, config analytics.Config, lib
 		moduleQuery := model.ModulQuery{TypeFilter: &libConfig.CamundaWorkerTopic}
 		smartServiceRepo.StartHealthCheck(ctx, interval, moduleQuery, healthCheck) //timer loop
 		smartServiceRepo.RunHealthCheck(moduleQuery, healthCheck)                  //initial check
+
+		if config.ReconcileInterval != "" {
+			reconcileInterval, err := time.ParseDuration(config.ReconcileInterval)
+			if err != nil {
+				return nil, err
+			}
+			handler.StartReconcileLoop(ctx, reconcileInterval, moduleQuery) //timer loop, independent of the health check
+		}
 		return handler, nil
 	}
 	return lib.Start(ctx, wg, libConfig, handlerFactory)
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/tests/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+)
+
+func TestDeviceLookupChunks(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const chunkSize = 3
+	const parallelism = 2
+
+	//11 devices of 3 device-types; names are in reverse id order, to check the result order
+	deviceList := []map[string]interface{}{}
+	for i := 0; i < 11; i++ {
+		deviceList = append(deviceList, map[string]interface{}{
+			"id":             "d" + strconv.Itoa(10+i),
+			"name":           "device " + strconv.Itoa(30-i),
+			"device_type_id": "dt" + strconv.Itoa(i%3),
+		})
+	}
+	repo := &mocks.DeviceRepo{}
+	repoUrl := repo.Start(ctx, wg)
+	repo.SetLegacyPermissionsResponses(map[string][]map[string]interface{}{"devices": deviceList})
+	repo.SetResponseDelay(50 * time.Millisecond)
+
+	client := devices.New(repoUrl, chunkSize, parallelism, httpclient.New(httpclient.NewTransport(), httpclient.Config{}))
+
+	t.Run("ids", func(t *testing.T) {
+		ids := []string{"unknown"}
+		for i := 10; i >= 0; i-- {
+			ids = append(ids, "d"+strconv.Itoa(10+i))
+		}
+		ids = append(ids, "d10") //duplicate
+		result, unreadable, err := client.GetDevicesWithIds(ctx, auth.Token{}, ids)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(result) != 11 {
+			t.Error("expected 11 devices, got", len(result))
+		}
+		for i, device := range result {
+			expectedName := "device " + strconv.Itoa(20+i)
+			if device.Name != expectedName {
+				t.Error("unexpected device order at", i, device.Name, expectedName)
+			}
+		}
+		if !reflect.DeepEqual(unreadable, []string{"unknown"}) {
+			t.Error("unexpected unreadable ids", unreadable)
+		}
+		checkDeviceLookupRequests(t, repo.PopRequestLog(), "ids", 12, chunkSize)
+		if max := repo.MaxParallelRequests(); max != parallelism {
+			t.Error("expected", parallelism, "parallel requests, got", max)
+		}
+	})
+
+	t.Run("device-types", func(t *testing.T) {
+		deviceTypeIds := []string{"dt0", "dt1", "dt2", "dt3", "dt4", "dt5", "dt6", "dt1"}
+		result, err := client.GetDevicesOfDeviceTypes(ctx, auth.Token{}, deviceTypeIds)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(result) != 11 {
+			t.Error("expected 11 devices, got", len(result))
+		}
+		for i, device := range result {
+			expectedName := "device " + strconv.Itoa(20+i)
+			if device.Name != expectedName {
+				t.Error("unexpected device order at", i, device.Name, expectedName)
+			}
+		}
+		checkDeviceLookupRequests(t, repo.PopRequestLog(), "device-type-ids", 7, chunkSize)
+	})
+}
+
+// checkDeviceLookupRequests checks that all distinct values of the list parameter were requested, in chunks of at most chunkSize values
+func checkDeviceLookupRequests(t *testing.T, requests []mocks.Request, parameter string, expectedValues int, chunkSize int) {
+	t.Helper()
+	requested := map[string]bool{}
+	for _, request := range requests {
+		query, err := url.ParseQuery(strings.TrimPrefix(request.Endpoint, "/devices?"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		values := strings.Split(query.Get(parameter), ",")
+		if len(values) > chunkSize {
+			t.Error("chunk exceeds chunk size:", request.Endpoint)
+		}
+		for _, value := range values {
+			requested[value] = true
+		}
+	}
+	if len(requested) != expectedValues {
+		t.Error("expected", expectedValues, "requested values, got", len(requested), requests)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/imports"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/tests/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+)
+
+func TestCachedImportsSkipUndeployed(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	importrepo := &mocks.Import{}
+	importUrl := importrepo.Start(ctx, wg)
+	importrepo.SetUndeployed([]string{"import_1"})
+
+	repo := imports.NewCached(imports.New(importUrl, importUrl, httpclient.New(httpclient.NewTransport(), httpclient.Config{})), time.Minute, 100)
+	token := auth.Token{}
+
+	getTopic := func(id string) string {
+		t.Helper()
+		importInstance, err := repo.GetImport(ctx, token, id)
+		if err != nil {
+			t.Error(err)
+		}
+		return importInstance.KafkaTopic
+	}
+
+	if topic := getTopic("import_1"); topic != "" {
+		t.Error("expected undeployed import", topic)
+	}
+	result, err := repo.GetImports(ctx, token, []string{"import_1", "import_2"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result["import_1"].KafkaTopic != "" || result["import_2"].KafkaTopic != "import_2_topic" {
+		t.Error("unexpected result", result)
+	}
+	if count := len(importrepo.PopRequestLog()); count != 3 {
+		t.Error("expected the undeployed import to be requested again, got", count, "requests")
+	}
+
+	//the user deploys the import
+	importrepo.SetUndeployed(nil)
+	if topic := getTopic("import_1"); topic != "import_1_topic" {
+		t.Error("expected deployed import", topic)
+	}
+	if topic := getTopic("import_1"); topic != "import_1_topic" {
+		t.Error("expected cached deployed import", topic)
+	}
+	if topic := getTopic("import_2"); topic != "import_2_topic" {
+		t.Error("expected cached deployed import", topic)
+	}
+	if count := len(importrepo.PopRequestLog()); count != 1 {
+		t.Error("expected deployed imports to be cached, got", count, "requests")
+	}
+}
+
+func TestGetImportsParallelism(t *testing.T) {
+	var running, maxRunning, requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			known := maxRunning.Load()
+			if current <= known || maxRunning.CompareAndSwap(known, current) {
+				break
+			}
+		}
+		requests.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		json.NewEncoder(writer).Encode(imports.Import{Id: request.URL.Path, KafkaTopic: "topic"})
+	}))
+	defer server.Close()
+
+	ids := []string{}
+	for i := 0; i < 3*imports.LookupParallelism; i++ {
+		ids = append(ids, "import_"+strconv.Itoa(i))
+	}
+	repo := imports.New(server.URL, server.URL, httpclient.New(httpclient.NewTransport(), httpclient.Config{}))
+	result, err := repo.GetImports(context.Background(), auth.Token{}, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != len(ids) || requests.Load() != int64(len(ids)) {
+		t.Error("unexpected result", len(result), requests.Load())
+	}
+	if maxRunning.Load() > imports.LookupParallelism {
+		t.Error("expected at most", imports.LookupParallelism, "concurrent requests, got", maxRunning.Load())
+	}
+}
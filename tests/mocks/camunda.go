@@ -36,6 +36,7 @@ func NewCamundaMock() *CamundaMock {
 type CamundaMock struct {
 	Queue       chan []model.CamundaExternalTask
 	requestsLog []Request
+	errorLog    []string
 	mux         sync.Mutex
 }
 
@@ -66,6 +67,21 @@ func (this *CamundaMock) PopRequestLog() []Request {
 	return result
 }
 
+// PopErrorLog returns the error messages of all reported task failures
+func (this *CamundaMock) PopErrorLog() []string {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	result := this.errorLog
+	this.errorLog = []string{}
+	return result
+}
+
+func (this *CamundaMock) logError(msg string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.errorLog = append(this.errorLog, msg)
+}
+
 func (this *CamundaMock) logRequest(r Request) {
 	this.mux.Lock()
 	defer this.mux.Unlock()
@@ -112,6 +128,22 @@ func (this *CamundaMock) getRouter() http.Handler {
 		writer.WriteHeader(200)
 	})
 
+	router.POST("/engine-rest/external-task/:taskId/failure", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+		temp, _ := io.ReadAll(request.Body)
+		this.logRequest(Request{
+			Method:   request.Method,
+			Endpoint: request.URL.Path,
+			Message:  string(temp),
+		})
+		failure := struct {
+			ErrorMessage string `json:"errorMessage"`
+			ErrorDetails string `json:"errorDetails"`
+		}{}
+		_ = json.Unmarshal(temp, &failure)
+		this.logError(failure.ErrorMessage + "\n" + failure.ErrorDetails)
+		writer.WriteHeader(204)
+	})
+
 	router.DELETE("/engine-rest/process-instance/:id", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 		temp, _ := io.ReadAll(request.Body)
 		this.logRequest(Request{
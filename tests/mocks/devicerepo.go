@@ -23,7 +23,12 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 type DeviceRepo struct {
@@ -33,6 +38,37 @@ type DeviceRepo struct {
 	SecondResponse  []devices.DeviceTypeSelectable
 	legacyResponses map[string]interface{}
 	called          bool
+	responseDelay   time.Duration
+	activeRequests  int
+	maxParallel     int
+}
+
+// SetResponseDelay delays every response, to make concurrent requests observable (see MaxParallelRequests)
+func (this *DeviceRepo) SetResponseDelay(delay time.Duration) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.responseDelay = delay
+}
+
+// MaxParallelRequests returns the highest number of concurrently handled requests
+func (this *DeviceRepo) MaxParallelRequests() int {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.maxParallel
+}
+
+func (this *DeviceRepo) startRequest() (delay time.Duration) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.activeRequests++
+	this.maxParallel = max(this.maxParallel, this.activeRequests)
+	return this.responseDelay
+}
+
+func (this *DeviceRepo) endRequest() {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.activeRequests--
 }
 
 func (this *DeviceRepo) SetDeviceTypeSelectablesResponse(value []devices.DeviceTypeSelectable) {
@@ -59,9 +95,13 @@ func (this *DeviceRepo) logRequest(request *http.Request) {
 	this.mux.Lock()
 	defer this.mux.Unlock()
 	temp, _ := io.ReadAll(request.Body)
+	endpoint := request.URL.Path
+	if request.URL.RawQuery != "" {
+		endpoint = endpoint + "?" + request.URL.Query().Encode()
+	}
 	this.requestsLog = append(this.requestsLog, Request{
 		Method:   request.Method,
-		Endpoint: request.URL.Path,
+		Endpoint: endpoint,
 		Message:  string(temp),
 	})
 }
@@ -98,6 +138,8 @@ func (this *DeviceRepo) Start(ctx context.Context, wg *sync.WaitGroup) (url stri
 func (this *DeviceRepo) getRouter() http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		this.logRequest(request)
+		time.Sleep(this.startRequest())
+		defer this.endRequest()
 		if request.Method == "POST" && request.URL.Path == "/v2/query/device-type-selectables" {
 			if this.called && this.SecondResponse != nil {
 				json.NewEncoder(writer).Encode(this.SecondResponse)
@@ -108,6 +150,9 @@ func (this *DeviceRepo) getRouter() http.Handler {
 			return
 		}
 		if resp, ok := this.legacyResponses[request.URL.Path]; ok {
+			if list, isList := resp.([]map[string]interface{}); isList && request.URL.Path == "/devices" {
+				resp = queryDevices(list, request.URL.Query())
+			}
 			json.NewEncoder(writer).Encode(resp)
 			return
 		}
@@ -127,3 +172,34 @@ func (this *DeviceRepo) SetLegacyPermissionsResponses(responses map[string][]map
 		}
 	}
 }
+
+// queryDevices applies the ids, device-type-ids, sort (name.asc only), offset and limit parameters of a device list request
+func queryDevices(list []map[string]interface{}, query url.Values) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	ids := strings.Split(query.Get("ids"), ",")
+	deviceTypeIds := strings.Split(query.Get("device-type-ids"), ",")
+	for _, device := range list {
+		id, _ := device["id"].(string)
+		deviceTypeId, _ := device["device_type_id"].(string)
+		if query.Has("ids") && !slices.Contains(ids, id) {
+			continue
+		}
+		if query.Has("device-type-ids") && !slices.Contains(deviceTypeIds, deviceTypeId) {
+			continue
+		}
+		result = append(result, device)
+	}
+	if query.Get("sort") == "name.asc" {
+		slices.SortStableFunc(result, func(a, b map[string]interface{}) int {
+			nameA, _ := a["name"].(string)
+			nameB, _ := b["name"].(string)
+			return strings.Compare(nameA, nameB)
+		})
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	result = result[min(offset, len(result)):]
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit < len(result) {
+		result = result[:limit]
+	}
+	return result
+}
@@ -37,6 +37,9 @@ func (this *FlowEngine) PopRequestLog() []Request {
 	this.mux.Lock()
 	defer this.mux.Unlock()
 	result := this.requestsLog
+	if result == nil {
+		result = []Request{}
+	}
 	this.requestsLog = []Request{}
 	return result
 }
@@ -31,6 +31,16 @@ type FlowParser struct {
 	requestsLog []Request
 	mux         sync.Mutex
 	Response    []analytics.FlowModelCell
+	errorStatus int
+	errorBody   string
+}
+
+// SetError lets /flow/getinputs/ respond with the given status code and body, instead of Response
+func (this *FlowParser) SetError(status int, body string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.errorStatus = status
+	this.errorBody = body
 }
 
 func (this *FlowParser) SetResponse(value []analytics.FlowModelCell) {
@@ -88,7 +98,14 @@ func (this *FlowParser) getRouter() http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		this.logRequest(request)
 		if request.Method == "GET" && strings.HasPrefix(request.URL.Path, "/flow/getinputs/") {
-			json.NewEncoder(writer).Encode(this.Response)
+			this.mux.Lock()
+			status, body, response := this.errorStatus, this.errorBody, this.Response
+			this.mux.Unlock()
+			if status != 0 {
+				http.Error(writer, body, status)
+				return
+			}
+			json.NewEncoder(writer).Encode(response)
 			return
 		}
 		http.Error(writer, "unknown path", 500)
@@ -29,9 +29,27 @@ import (
 
 type Import struct {
 	requestsLog []Request
+	importTypes map[string]imports.ImportType
+	undeployed  map[string]bool
 	mux         sync.Mutex
 }
 
+// SetUndeployed marks import instances as not deployed; they are returned without kafka topic
+func (this *Import) SetUndeployed(ids []string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.undeployed = map[string]bool{}
+	for _, id := range ids {
+		this.undeployed[id] = true
+	}
+}
+
+func (this *Import) SetImportTypes(value map[string]imports.ImportType) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.importTypes = value
+}
+
 func (this *Import) PopRequestLog() []Request {
 	this.mux.Lock()
 	defer this.mux.Unlock()
@@ -81,9 +99,29 @@ func (this *Import) getRouter() http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		this.logRequest(request)
 		if request.Method == "GET" && strings.HasPrefix(request.URL.Path, "/instances/") {
-			json.NewEncoder(writer).Encode(imports.Import{
-				KafkaTopic: strings.TrimPrefix(request.URL.Path, "/instances/") + "_topic",
-			})
+			id := strings.TrimPrefix(request.URL.Path, "/instances/")
+			importInstance := imports.Import{
+				Id:           id,
+				ImportTypeId: id + "_type",
+				KafkaTopic:   id + "_topic",
+			}
+			this.mux.Lock()
+			if this.undeployed[id] {
+				importInstance.KafkaTopic = ""
+			}
+			this.mux.Unlock()
+			json.NewEncoder(writer).Encode(importInstance)
+			return
+		}
+		if request.Method == "GET" && strings.HasPrefix(request.URL.Path, "/import-types/") {
+			this.mux.Lock()
+			importType, ok := this.importTypes[strings.TrimPrefix(request.URL.Path, "/import-types/")]
+			this.mux.Unlock()
+			if !ok {
+				http.Error(writer, "not found", 404)
+				return
+			}
+			json.NewEncoder(writer).Encode(importType)
 			return
 		}
 		http.Error(writer, "unknown path", 500)
@@ -35,10 +35,12 @@ func NewSmartServiceRepoMock(libConfig configuration.Config, config analytics.Co
 
 type SmartServiceRepoMock struct {
 	requestsLog        []Request
+	errorLog           []string
 	mux                sync.Mutex
 	libConfig          configuration.Config
 	config             analytics.Config
 	moduleListResponse []byte
+	applyModuleUpdates bool
 }
 
 func (this *SmartServiceRepoMock) PopRequestLog() []Request {
@@ -49,6 +51,21 @@ func (this *SmartServiceRepoMock) PopRequestLog() []Request {
 	return result
 }
 
+// PopErrorLog returns the error messages of all reported instance errors
+func (this *SmartServiceRepoMock) PopErrorLog() []string {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	result := this.errorLog
+	this.errorLog = []string{}
+	return result
+}
+
+func (this *SmartServiceRepoMock) logError(msg string) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.errorLog = append(this.errorLog, msg)
+}
+
 func (this *SmartServiceRepoMock) logRequest(r Request) {
 	this.mux.Lock()
 	defer this.mux.Unlock()
@@ -76,6 +93,11 @@ func (this *SmartServiceRepoMock) getRouter() http.Handler {
 			Endpoint: request.URL.Path,
 			Message:  string(temp),
 		})
+		var msg string
+		if json.Unmarshal(temp, &msg) != nil {
+			msg = string(temp)
+		}
+		this.logError(msg)
 		writer.WriteHeader(200)
 	})
 
@@ -87,6 +109,7 @@ func (this *SmartServiceRepoMock) getRouter() http.Handler {
 			Endpoint: request.URL.Path,
 			Message:  msg,
 		})
+		this.applyModuleUpdate(params.ByName("moduleId"), temp)
 		writer.Write(temp)
 	})
 
@@ -108,7 +131,7 @@ func (this *SmartServiceRepoMock) getRouter() http.Handler {
 			Endpoint: request.URL.Path + "?" + request.URL.Query().Encode(),
 			Message:  msg,
 		})
-		writer.Write(this.moduleListResponse)
+		writer.Write(this.getListResponse())
 	})
 
 	router.GET("/instances-by-process-id/:id/variables-map", func(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -137,5 +160,46 @@ func (this *SmartServiceRepoMock) getRouter() http.Handler {
 }
 
 func (this *SmartServiceRepoMock) SetListResponse(response []byte) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
 	this.moduleListResponse = response
 }
+
+func (this *SmartServiceRepoMock) getListResponse() []byte {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	return this.moduleListResponse
+}
+
+// ApplyModuleUpdates lets module updates replace the module data of the matching module in the list response
+func (this *SmartServiceRepoMock) ApplyModuleUpdates() {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.applyModuleUpdates = true
+}
+
+func (this *SmartServiceRepoMock) applyModuleUpdate(moduleId string, update []byte) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if !this.applyModuleUpdates {
+		return
+	}
+	var modules []map[string]interface{}
+	if json.Unmarshal(this.moduleListResponse, &modules) != nil {
+		return
+	}
+	var module map[string]interface{}
+	if json.Unmarshal(update, &module) != nil {
+		return
+	}
+	for _, listed := range modules {
+		if listed["id"] == moduleId {
+			listed["module_data"] = module["module_data"]
+		}
+	}
+	temp, err := json.Marshal(modules)
+	if err != nil {
+		return
+	}
+	this.moduleListResponse = temp
+}
@@ -22,11 +22,14 @@ import (
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg"
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/analytics"
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/imports"
 	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/tests/mocks"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/configuration"
 	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
 	"os"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -42,7 +45,7 @@ func TestWithMocks(t *testing.T) {
 	}
 	for _, info := range infos {
 		name := info.Name()
-		if info.IsDir() && isValidaForMockTest(RESOURCE_BASE_DIR+name) {
+		if info.IsDir() && isValidaForMockTest(name) {
 			t.Run(name, func(t *testing.T) {
 				mockTest(t, name)
 			})
@@ -50,12 +53,14 @@ func TestWithMocks(t *testing.T) {
 	}
 }
 
-func prepareMocks(ctx context.Context, wg *sync.WaitGroup) (
+// configure may adjust the analytics config loaded from ../config.json
+func prepareMocks(ctx context.Context, wg *sync.WaitGroup, configure ...func(conf *analytics.Config)) (
 	libConf configuration.Config,
 	conf analytics.Config,
 	camunda *mocks.CamundaMock,
 	smartServiceRepo *mocks.SmartServiceRepoMock,
 	devicerepo *mocks.DeviceRepo,
+	importrepo *mocks.Import,
 	flowparser *mocks.FlowParser,
 	flowengine *mocks.FlowEngine,
 	err error,
@@ -68,6 +73,9 @@ func prepareMocks(ctx context.Context, wg *sync.WaitGroup) (
 	if err != nil {
 		return
 	}
+	for _, f := range configure {
+		f(&conf)
+	}
 	libConf.CamundaWorkerWaitDurationInMs = 200
 
 	camunda = mocks.NewCamundaMock()
@@ -78,8 +86,9 @@ func prepareMocks(ctx context.Context, wg *sync.WaitGroup) (
 	devicerepo = &mocks.DeviceRepo{}
 	conf.DeviceRepositoryUrl = devicerepo.Start(ctx, wg)
 
-	imports := &mocks.Import{}
-	conf.ImportDeployUrl = imports.Start(ctx, wg)
+	importrepo = &mocks.Import{}
+	conf.ImportDeployUrl = importrepo.Start(ctx, wg)
+	conf.ImportRepositoryUrl = conf.ImportDeployUrl
 
 	flowparser = &mocks.FlowParser{}
 	conf.FlowParserUrl = flowparser.Start(ctx, wg)
@@ -95,18 +104,61 @@ func prepareMocks(ctx context.Context, wg *sync.WaitGroup) (
 	return
 }
 
-func isValidaForMockTest(dir string) bool {
-	return checkFileExistence(dir, []string{
+// test cases expecting a task failure (expected_errors.json) may omit the expected camunda and smart-service-repo requests
+func isValidaForMockTest(name string) bool {
+	if !checkCaseFileExistence(name, []string{
 		"camunda_tasks.json",
-		"expected_camunda_requests.json",
-		"expected_smart_service_repo_requests.json",
 		"device_type_selectables.json",
 		"permissions_query_responses.json",
 		"flow_model_cells.json",
 		"expected_engine_requests.json",
+	}) {
+		return false
+	}
+	return checkCaseFileExistence(name, []string{"expected_errors.json"}) || checkCaseFileExistence(name, []string{
+		"expected_camunda_requests.json",
+		"expected_smart_service_repo_requests.json",
 	})
 }
 
+// inheritableCaseFiles are the mock responses a test case with a base.json may omit
+// base.json contains the name of another test case, from which the missing files are read
+var inheritableCaseFiles = []string{
+	"device_type_selectables.json",
+	"device_type_selectables_2.json",
+	"permissions_query_responses.json",
+	"flow_model_cells.json",
+	"import_types.json",
+	"module_list_response.json",
+}
+
+// caseFile returns the path of file in the test case directory, or in the directory of its base case
+func caseFile(name string, file string) string {
+	path := RESOURCE_BASE_DIR + name + "/" + file
+	if checkFileExistence(RESOURCE_BASE_DIR+name, []string{file}) || !slices.Contains(inheritableCaseFiles, file) {
+		return path
+	}
+	baseFile, err := os.ReadFile(caseFile(name, "base.json"))
+	if err != nil {
+		return path
+	}
+	var base string
+	err = json.Unmarshal(baseFile, &base)
+	if err != nil || base == "" || base == name {
+		return path
+	}
+	return caseFile(base, file)
+}
+
+func checkCaseFileExistence(name string, expectedFiles []string) bool {
+	for _, file := range expectedFiles {
+		if _, err := os.Stat(caseFile(name, file)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
 func checkFileExistence(dir string, expectedFiles []string) bool {
 	infos, err := os.ReadDir(dir)
 	if err != nil {
@@ -136,13 +188,13 @@ func mockTest(
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	_, _, camunda, repo, devicerepo, flowparser, flowengine, err := prepareMocks(ctx, wg)
+	_, _, camunda, repo, devicerepo, importrepo, flowparser, flowengine, err := prepareMocks(ctx, wg)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	flowModelCellsFile, err := os.ReadFile(RESOURCE_BASE_DIR + name + "/flow_model_cells.json")
+	flowModelCellsFile, err := os.ReadFile(caseFile(name, "flow_model_cells.json"))
 	if err != nil {
 		t.Error(err)
 		return
@@ -155,12 +207,30 @@ func mockTest(
 	}
 	flowparser.SetResponse(flowModelCells)
 
-	moduleListResponse, err := os.ReadFile(RESOURCE_BASE_DIR + name + "/module_list_response.json")
+	if checkCaseFileExistence(name, []string{"flow_parser_error.json"}) {
+		flowParserErrorFile, err := os.ReadFile(caseFile(name, "flow_parser_error.json"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var flowParserError struct {
+			Status int    `json:"status"`
+			Body   string `json:"body"`
+		}
+		err = json.Unmarshal(flowParserErrorFile, &flowParserError)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		flowparser.SetError(flowParserError.Status, flowParserError.Body)
+	}
+
+	moduleListResponse, err := os.ReadFile(caseFile(name, "module_list_response.json"))
 	if err == nil {
 		repo.SetListResponse(moduleListResponse)
 	}
 
-	deviceTypeSelectablesFile, err := os.ReadFile(RESOURCE_BASE_DIR + name + "/device_type_selectables.json")
+	deviceTypeSelectablesFile, err := os.ReadFile(caseFile(name, "device_type_selectables.json"))
 	if err != nil {
 		t.Error(err)
 		return
@@ -173,8 +243,8 @@ func mockTest(
 	}
 	devicerepo.SetDeviceTypeSelectablesResponse(deviceTypeSelectables)
 
-	if checkFileExistence(RESOURCE_BASE_DIR+name, []string{"device_type_selectables_2.json"}) {
-		deviceTypeSelectablesFile2, err := os.ReadFile(RESOURCE_BASE_DIR + name + "/device_type_selectables_2.json")
+	if checkCaseFileExistence(name, []string{"device_type_selectables_2.json"}) {
+		deviceTypeSelectablesFile2, err := os.ReadFile(caseFile(name, "device_type_selectables_2.json"))
 		if err != nil {
 			t.Error(err)
 			return
@@ -188,44 +258,50 @@ func mockTest(
 		devicerepo.SetSecondResponse(deviceTypeSelectables2)
 	}
 
-	permissionsQueryResponsesFile, err := os.ReadFile(RESOURCE_BASE_DIR + name + "/permissions_query_responses.json")
-	if err != nil {
-		t.Error(err)
-		return
-	}
-	var permissionsQueryResponses map[string][]map[string]interface{}
-	err = json.Unmarshal(permissionsQueryResponsesFile, &permissionsQueryResponses)
-	if err != nil {
-		t.Error(err)
-		return
+	if checkCaseFileExistence(name, []string{"import_types.json"}) {
+		importTypesFile, err := os.ReadFile(caseFile(name, "import_types.json"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var importTypes map[string]imports.ImportType
+		err = json.Unmarshal(importTypesFile, &importTypes)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		importrepo.SetImportTypes(importTypes)
 	}
-	devicerepo.SetLegacyPermissionsResponses(permissionsQueryResponses)
 
-	expectedCamundaRequestsFile, err := os.ReadFile(RESOURCE_BASE_DIR + name + "/expected_camunda_requests.json")
-	if err != nil {
-		t.Error(err)
-		return
-	}
-	var expectedCamundaRequests []mocks.Request
-	err = json.Unmarshal(expectedCamundaRequestsFile, &expectedCamundaRequests)
-	if err != nil {
-		t.Error(err)
-		return
+	if checkCaseFileExistence(name, []string{"undeployed_imports.json"}) {
+		undeployedImportsFile, err := os.ReadFile(caseFile(name, "undeployed_imports.json"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var undeployedImports []string
+		err = json.Unmarshal(undeployedImportsFile, &undeployedImports)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		importrepo.SetUndeployed(undeployedImports)
 	}
 
-	expectedSmartServiceRepoRequestsFile, err := os.ReadFile(RESOURCE_BASE_DIR + name + "/expected_smart_service_repo_requests.json")
+	permissionsQueryResponsesFile, err := os.ReadFile(caseFile(name, "permissions_query_responses.json"))
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	var expectedSmartServiceRepoRequests []mocks.Request
-	err = json.Unmarshal(expectedSmartServiceRepoRequestsFile, &expectedSmartServiceRepoRequests)
+	var permissionsQueryResponses map[string][]map[string]interface{}
+	err = json.Unmarshal(permissionsQueryResponsesFile, &permissionsQueryResponses)
 	if err != nil {
 		t.Error(err)
 		return
 	}
+	devicerepo.SetLegacyPermissionsResponses(permissionsQueryResponses)
 
-	expectedEngineRequestsFile, err := os.ReadFile(RESOURCE_BASE_DIR + name + "/expected_engine_requests.json")
+	expectedEngineRequestsFile, err := os.ReadFile(caseFile(name, "expected_engine_requests.json"))
 	if err != nil {
 		t.Error(err)
 		return
@@ -237,7 +313,7 @@ func mockTest(
 		return
 	}
 
-	tasksFile, err := os.ReadFile(RESOURCE_BASE_DIR + name + "/camunda_tasks.json")
+	tasksFile, err := os.ReadFile(caseFile(name, "camunda_tasks.json"))
 	if err != nil {
 		t.Error(err)
 		return
@@ -252,18 +328,71 @@ func mockTest(
 
 	time.Sleep(1 * time.Second)
 
-	actualCamundaRequests := camunda.PopRequestLog()
-	if !reflect.DeepEqual(expectedCamundaRequests, actualCamundaRequests) {
-		e, _ := json.Marshal(expectedCamundaRequests)
-		a, _ := json.Marshal(actualCamundaRequests)
-		t.Error("\n", string(e), "\n", string(a))
+	if checkCaseFileExistence(name, []string{"expected_camunda_requests.json"}) {
+		expectedCamundaRequestsFile, err := os.ReadFile(caseFile(name, "expected_camunda_requests.json"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var expectedCamundaRequests []mocks.Request
+		err = json.Unmarshal(expectedCamundaRequestsFile, &expectedCamundaRequests)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		actualCamundaRequests := camunda.PopRequestLog()
+		if !reflect.DeepEqual(expectedCamundaRequests, actualCamundaRequests) {
+			e, _ := json.Marshal(expectedCamundaRequests)
+			a, _ := json.Marshal(actualCamundaRequests)
+			t.Error("\n", string(e), "\n", string(a))
+		}
+	}
+
+	if checkCaseFileExistence(name, []string{"expected_smart_service_repo_requests.json"}) {
+		expectedSmartServiceRepoRequestsFile, err := os.ReadFile(caseFile(name, "expected_smart_service_repo_requests.json"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var expectedSmartServiceRepoRequests []mocks.Request
+		err = json.Unmarshal(expectedSmartServiceRepoRequestsFile, &expectedSmartServiceRepoRequests)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		actualSmartServiceRepoRequests := repo.PopRequestLog()
+		if !reflect.DeepEqual(expectedSmartServiceRepoRequests, actualSmartServiceRepoRequests) {
+			e, _ := json.Marshal(expectedSmartServiceRepoRequests)
+			a, _ := json.Marshal(actualSmartServiceRepoRequests)
+			t.Error("\n", string(e), "\n", string(a))
+		}
 	}
 
-	actualSmartServiceRepoRequests := repo.PopRequestLog()
-	if !reflect.DeepEqual(expectedSmartServiceRepoRequests, actualSmartServiceRepoRequests) {
-		e, _ := json.Marshal(expectedSmartServiceRepoRequests)
-		a, _ := json.Marshal(actualSmartServiceRepoRequests)
-		t.Error("\n", string(e), "\n", string(a))
+	//expected_errors.json contains substrings, each of which must be part of a reported task error
+	expectedErrors := []string{}
+	if checkCaseFileExistence(name, []string{"expected_errors.json"}) {
+		expectedErrorsFile, err := os.ReadFile(caseFile(name, "expected_errors.json"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		err = json.Unmarshal(expectedErrorsFile, &expectedErrors)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	actualErrors := append(camunda.PopErrorLog(), repo.PopErrorLog()...)
+	if len(expectedErrors) == 0 && len(actualErrors) > 0 {
+		t.Error("unexpected task errors:\n", strings.Join(actualErrors, "\n"))
+	}
+	if len(expectedErrors) > 0 && len(actualErrors) == 0 {
+		t.Error("missing task error, expected:\n", strings.Join(expectedErrors, "\n"))
+	}
+	for _, expected := range expectedErrors {
+		if !slices.ContainsFunc(actualErrors, func(actual string) bool { return strings.Contains(actual, expected) }) {
+			t.Error("missing in reported task errors:", expected, "\n", strings.Join(actualErrors, "\n"))
+		}
 	}
 
 	actualEngineRequests := flowengine.PopRequestLog()
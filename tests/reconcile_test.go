@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/analytics"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/tests/mocks"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/model"
+)
+
+// TestReconcile uses the group-update test case: the task updates the pipeline of the keyed module and stores the request hash,
+// the reconcile loop ignores the module until its pipeline_request_hash is outdated, then updates the pipeline once and stores the new hash
+func TestReconcile(t *testing.T) {
+	const name = "group-update"
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, _, camunda, repo, devicerepo, _, flowparser, flowengine, err := prepareMocks(ctx, wg, func(conf *analytics.Config) {
+		conf.ReconcileInterval = "100ms"
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var flowModelCells []analytics.FlowModelCell
+	err = readJsonFile(caseFile(name, "flow_model_cells.json"), &flowModelCells)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	flowparser.SetResponse(flowModelCells)
+
+	var deviceTypeSelectables []devices.DeviceTypeSelectable
+	err = readJsonFile(caseFile(name, "device_type_selectables.json"), &deviceTypeSelectables)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	devicerepo.SetDeviceTypeSelectablesResponse(deviceTypeSelectables)
+
+	var permissionsQueryResponses map[string][]map[string]interface{}
+	err = readJsonFile(caseFile(name, "permissions_query_responses.json"), &permissionsQueryResponses)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	devicerepo.SetLegacyPermissionsResponses(permissionsQueryResponses)
+
+	var tasks []model.CamundaExternalTask
+	err = readJsonFile(caseFile(name, "camunda_tasks.json"), &tasks)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var modules []map[string]interface{}
+	err = readJsonFile(caseFile(name, "module_list_response.json"), &modules)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	modules[0]["instance_id"] = tasks[0].ProcessInstanceId
+	modules[0]["user_id"] = "ebbad927-4c39-4d12-8690-89b067dd4ce7"
+	moduleListResponse, err := json.Marshal(modules)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	repo.SetListResponse(moduleListResponse)
+	repo.ApplyModuleUpdates()
+
+	reconcileVariables := map[string]interface{}{}
+	for variableName, variable := range tasks[0].Variables {
+		if strings.HasPrefix(variableName, "analytics.") && variableName != "analytics.module_data" {
+			reconcileVariables[variableName] = variable
+		}
+	}
+	modules[0]["module_data"].(map[string]interface{})[analytics.ReconcileVariablesField] = reconcileVariables
+	modules[0]["module_data"].(map[string]interface{})[analytics.PipelineRequestHashField] = "outdated"
+	outdatedModuleListResponse, err := json.Marshal(modules)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	log := &requestLogs{flowengine: flowengine, repo: repo}
+
+	camunda.AddToQueue(tasks)
+
+	t.Run("task update", func(t *testing.T) {
+		log.waitFor(t, func() bool {
+			return log.count(log.engineRequests, "PUT", "/pipeline") == 1 && log.count(log.repoRequests, "PUT", "/instances-by-process-id/"+tasks[0].ProcessInstanceId+"/modules/") == 1
+		})
+	})
+
+	t.Run("stored hash is unchanged", func(t *testing.T) {
+		log.waitForModuleLists(t, tasks[0].ProcessInstanceId, 2)
+		checkPipelineUpdates(t, log.popEngineRequests(), 1)
+	})
+
+	t.Run("outdated hash is reconciled", func(t *testing.T) {
+		log.popRepoRequests()
+		repo.SetListResponse(outdatedModuleListResponse)
+		log.waitFor(t, func() bool {
+			return log.count(log.engineRequests, "PUT", "/pipeline") == 1 && log.count(log.repoRequests, "PUT", "/instances-by-process-id/"+tasks[0].ProcessInstanceId+"/modules/") == 1
+		})
+		for _, request := range log.popRepoRequests() {
+			if request.Method == "PUT" && strings.Contains(request.Message, "outdated") {
+				t.Error("outdated hash was not replaced", request.Message)
+			}
+		}
+	})
+
+	t.Run("reconciled hash is kept", func(t *testing.T) {
+		log.waitForModuleLists(t, tasks[0].ProcessInstanceId, 2)
+		checkPipelineUpdates(t, log.popEngineRequests(), 1)
+	})
+}
+
+// requestLogs collects the requests of the flow-engine and smart-service-repository mocks
+type requestLogs struct {
+	flowengine     *mocks.FlowEngine
+	repo           *mocks.SmartServiceRepoMock
+	engineRequests []mocks.Request
+	repoRequests   []mocks.Request
+}
+
+func (this *requestLogs) update() {
+	this.engineRequests = append(this.engineRequests, this.flowengine.PopRequestLog()...)
+	this.repoRequests = append(this.repoRequests, this.repo.PopRequestLog()...)
+}
+
+func (this *requestLogs) popEngineRequests() (result []mocks.Request) {
+	this.update()
+	result, this.engineRequests = this.engineRequests, nil
+	return result
+}
+
+func (this *requestLogs) popRepoRequests() (result []mocks.Request) {
+	this.update()
+	result, this.repoRequests = this.repoRequests, nil
+	return result
+}
+
+func (this *requestLogs) count(requests []mocks.Request, method string, endpointPrefix string) (count int) {
+	for _, request := range requests {
+		if request.Method == method && strings.HasPrefix(request.Endpoint, endpointPrefix) {
+			count++
+		}
+	}
+	return count
+}
+
+// waitFor polls the mocks until condition is true and fails the test after 10s
+func (this *requestLogs) waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		this.update()
+		if condition() {
+			return
+		}
+		if time.Now().After(deadline) {
+			temp, _ := json.Marshal(map[string][]mocks.Request{"flow-engine": this.engineRequests, "smart-service-repository": this.repoRequests})
+			t.Fatal("timeout while waiting for expected requests\n", string(temp))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForModuleLists waits until the reconcile loop listed the modules of the process instance another count times
+func (this *requestLogs) waitForModuleLists(t *testing.T, processInstanceId string, count int) {
+	t.Helper()
+	this.popRepoRequests()
+	this.waitFor(t, func() bool {
+		return this.count(this.repoRequests, "GET", "/instances-by-process-id/"+processInstanceId+"/modules?") >= count
+	})
+}
+
+func checkPipelineUpdates(t *testing.T, requests []mocks.Request, expectedCount int) {
+	t.Helper()
+	count := 0
+	for _, request := range requests {
+		if request.Method == "PUT" && request.Endpoint == "/pipeline" {
+			count++
+		}
+	}
+	if count != expectedCount {
+		temp, _ := json.Marshal(requests)
+		t.Error("expected", expectedCount, "pipeline updates, got", count, "\n", string(temp))
+	}
+}
+
+func readJsonFile(location string, result interface{}) error {
+	temp, err := os.ReadFile(location)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(temp, result)
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2022 InfAI (CC SES)
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/analytics"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/devices"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/httpclient"
+	"github.com/SENERGY-Platform/smart-service-module-worker-analytics/pkg/imports"
+	"github.com/SENERGY-Platform/smart-service-module-worker-lib/pkg/auth"
+)
+
+// TestDeviceAndImportUpstreamErrors checks that device-repository and import errors are classified like flow-engine errors
+func TestDeviceAndImportUpstreamErrors(t *testing.T) {
+	ctx := context.Background()
+	token := auth.Token{}
+	client := httpclient.New(httpclient.NewTransport(), httpclient.Config{Timeout: 100 * time.Millisecond})
+
+	requests := map[string]func(url string) error{
+		"device-repository: GetDevicesWithIds": func(url string) error {
+			_, _, err := devices.New(url, 0, 0, client).GetDevicesWithIds(ctx, token, []string{"d1"})
+			return err
+		},
+		"device-repository: GetDevicesOfDeviceTypes": func(url string) error {
+			_, err := devices.New(url, 0, 0, client).GetDevicesOfDeviceTypes(ctx, token, []string{"dt1"})
+			return err
+		},
+		"device-repository: GetDeviceGroup": func(url string) error {
+			_, err := devices.New(url, 0, 0, client).GetDeviceGroup(ctx, token, "g1")
+			return err
+		},
+		"device-repository: GetDeviceTypeSelectables": func(url string) error {
+			_, err := devices.New(url, 0, 0, client).GetDeviceTypeSelectables(ctx, token, nil, true, true)
+			return err
+		},
+		"import-deploy: GetImport": func(url string) error {
+			_, err := imports.New(url, url, client).GetImport(ctx, token, "i1")
+			return err
+		},
+		"import-deploy: GetImports": func(url string) error {
+			_, err := imports.New(url, url, client).GetImports(ctx, token, []string{"i1", "i2"})
+			return err
+		},
+		"import-repository: GetImportType": func(url string) error {
+			_, err := imports.New(url, url, client).GetImportType(ctx, token, "it1")
+			return err
+		},
+	}
+
+	upstreams := map[string]string{
+		"device-repository": analytics.UpstreamDeviceRepository,
+		"import-deploy":     analytics.UpstreamImportDeploy,
+		"import-repository": analytics.UpstreamImportRepository,
+	}
+
+	refused := httptest.NewServer(http.NotFoundHandler())
+	refused.Close()
+
+	for _, tc := range []struct {
+		name      string
+		handler   http.HandlerFunc
+		url       string
+		transient bool
+		kind      error
+	}{
+		{name: "503", handler: statusHandler(http.StatusServiceUnavailable), transient: true},
+		{name: "502", handler: statusHandler(http.StatusBadGateway), transient: true},
+		{name: "500", handler: statusHandler(http.StatusInternalServerError), transient: false},
+		{name: "429", handler: statusHandler(http.StatusTooManyRequests), transient: true},
+		{name: "timeout", handler: func(writer http.ResponseWriter, request *http.Request) {
+			time.Sleep(300 * time.Millisecond)
+		}, transient: true},
+		{name: "connection refused", url: refused.URL, transient: true},
+		{name: "unsupported scheme", url: "ftp://localhost", transient: false},
+		{name: "404", handler: statusHandler(http.StatusNotFound), transient: false},
+		{name: "400", handler: statusHandler(http.StatusBadRequest), transient: false},
+		{name: "403", handler: statusHandler(http.StatusForbidden), transient: false, kind: analytics.ErrForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			url := tc.url
+			if tc.handler != nil {
+				server := httptest.NewServer(tc.handler)
+				defer server.Close()
+				url = server.URL
+			}
+			for name, request := range requests {
+				err := request(url)
+				if err == nil {
+					t.Error(name, "expected error")
+					continue
+				}
+				if analytics.IsTransientError(err) != tc.transient {
+					t.Error(name, "unexpected transient classification", err)
+				}
+				if tc.kind != nil && !errors.Is(err, tc.kind) {
+					t.Error(name, "unexpected kind", err)
+				}
+				var upstreamErr *analytics.UpstreamError
+				if !errors.As(err, &upstreamErr) {
+					t.Error(name, "expected UpstreamError", err)
+					continue
+				}
+				for prefix, upstream := range upstreams {
+					if len(name) > len(prefix) && name[:len(prefix)] == prefix && upstreamErr.Upstream != upstream {
+						t.Error(name, "unexpected upstream", upstreamErr.Upstream)
+					}
+				}
+			}
+		})
+	}
+}
+
+func statusHandler(status int) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(status)
+	}
+}